@@ -2,6 +2,8 @@ package test
 
 import (
 	"Monkey/ast"
+	"Monkey/lexer"
+	"Monkey/parser"
 	"Monkey/token"
 	"testing"
 )
@@ -26,3 +28,15 @@ func TestString(t *testing.T) {
 		t.Fatalf("program.String() want [let myVar=anothervar;], but got %v", program.String())
 	}
 }
+
+func TestFunctionNameIsNotPrinted(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { x };")).ParseProgram()
+	let := program.Statements[0].(*ast.LetStatement)
+	if fn := let.Value.(*ast.FunctionLiteral); fn.Name != "f" {
+		t.Fatalf("function name not set. got=%q", fn.Name)
+	}
+
+	if program.String() != "let f=fn(x){ x };" {
+		t.Fatalf("program.String() want [let f=fn(x){ x };], but got %v", program.String())
+	}
+}
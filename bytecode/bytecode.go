@@ -0,0 +1,335 @@
+// Package bytecode 定义编译结果的二进制文件格式（.mkc），用于一次编译、多次运行
+//
+// 文件布局，多字节的定长整数均为大端编码，长度和计数使用uvarint：
+//
+//	magic     4字节 "MKBC"
+//	version   uint16
+//	main      顶层函数：指令和源码映射
+//	constants 常量个数，每个常量为1字节类型标记加上该类型的编码
+//	globals   全局变量个数，每项为下标和名称，运行时用于绑定args
+//	source    源码，用于错误信息中的代码片段，可以为空
+//	checksum  uint32，前面所有字节的CRC-32（IEEE）
+//
+// 指令直接使用code包的操作码，增删或重排操作码时必须增加Version
+package bytecode
+
+import (
+	"Monkey/code"
+	"Monkey/compiler"
+	"Monkey/object"
+	"Monkey/token"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"sort"
+)
+
+const (
+	Magic   = "MKBC"
+	Version = 1
+
+	headerSize   = len(Magic) + 2
+	checksumSize = 4
+)
+
+// 常量的类型标记
+// 只有编译器会放入常量池的类型才能序列化：布尔值和null由OpTrue、OpNull等指令产生，
+// 数组和哈希表在运行时由OpArray、OpHash构造，闭包、内置函数和迭代器只存在于运行时
+const (
+	tagInteger byte = iota + 1
+	tagBigInt
+	tagFloat
+	tagString
+	tagCompiledFunction
+)
+
+// File 字节码文件的内容
+type File struct {
+	Bytecode *compiler.Bytecode
+	Globals  map[int]string // 全局变量下标到名称的映射
+	Source   string         // 编译时的源码
+}
+
+// IsBytecode 根据文件头判断data是否为字节码文件
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Encode 把f编码为字节码文件，常量池中有无法序列化的对象时返回错误
+func Encode(f *File) ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(Magic)
+	binary.Write(&e.buf, binary.BigEndian, uint16(Version))
+
+	e.bytes(f.Bytecode.Instructions)
+	e.sourceMap(f.Bytecode.SourceMap)
+
+	e.uvarint(uint64(len(f.Bytecode.Constants)))
+	for i, constant := range f.Bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	e.uvarint(uint64(len(f.Globals)))
+	for _, index := range sortedKeys(f.Globals) {
+		e.uvarint(uint64(index))
+		e.string(f.Globals[index])
+	}
+	e.string(f.Source)
+
+	binary.Write(&e.buf, binary.BigEndian, crc32.ChecksumIEEE(e.buf.Bytes()))
+	return e.buf.Bytes(), nil
+}
+
+// Decode 校验并解码字节码文件
+func Decode(data []byte) (*File, error) {
+	if !IsBytecode(data) {
+		return nil, errors.New("not a Monkey bytecode file")
+	}
+	if len(data) < headerSize+checksumSize {
+		return nil, errors.New("bytecode file is truncated")
+	}
+	if version := binary.BigEndian.Uint16(data[len(Magic):]); version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, Version)
+	}
+	body := data[:len(data)-checksumSize]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, errors.New("bytecode checksum mismatch, the file is corrupted")
+	}
+
+	d := &decoder{data: body, pos: headerSize}
+	f := &File{Bytecode: &compiler.Bytecode{}, Globals: map[int]string{}}
+	f.Bytecode.Instructions = d.bytes()
+	f.Bytecode.SourceMap = d.sourceMap()
+
+	count := d.count()
+	f.Bytecode.Constants = make([]object.Object, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		f.Bytecode.Constants = append(f.Bytecode.Constants, d.constant())
+	}
+
+	count = d.count()
+	for i := 0; i < count && d.err == nil; i++ {
+		index := d.int()
+		f.Globals[index] = d.string()
+	}
+	f.Source = d.string()
+
+	if d.err == nil && d.pos != len(body) {
+		d.err = errors.New("unexpected data after the end of bytecode")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return f, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) sourceMap(sm code.SourceMap) {
+	e.uvarint(uint64(len(sm)))
+	for _, sp := range sm {
+		e.uvarint(uint64(sp.Offset))
+		e.string(sp.Pos.File)
+		e.uvarint(uint64(sp.Pos.Line))
+		e.uvarint(uint64(sp.Pos.Column))
+		e.uvarint(uint64(sp.Pos.Offset))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.varint(obj.Value)
+	case *object.BigInt:
+		e.buf.WriteByte(tagBigInt)
+		e.buf.WriteByte(byte(obj.Value.Sign() + 1)) // 0为负数，1为零，2为正数
+		e.bytes(obj.Value.Bytes())
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		binary.Write(&e.buf, binary.BigEndian, math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagCompiledFunction)
+		e.bytes(obj.Instructions)
+		e.uvarint(uint64(obj.NumLocals))
+		e.uvarint(uint64(obj.NumParameters))
+		e.string(obj.Name)
+		e.sourceMap(obj.SourceMap)
+	default:
+		return fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+	return nil
+}
+
+// decoder 按顺序读取字段，第一次出错后err不再改变，后续读取都返回零值
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bytecode file is truncated at byte %d", d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bytecode file is truncated at byte %d", d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// int 读取非负整数，超出int范围时报错
+func (d *decoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.fail("value %d out of range at byte %d", v, d.pos)
+		return 0
+	}
+	return int(v)
+}
+
+// count 读取元素个数，每个元素至少占一个字节，超过剩余长度说明文件已经损坏
+func (d *decoder) count() int {
+	n := d.int()
+	if n > len(d.data)-d.pos {
+		d.fail("bytecode file is truncated at byte %d", d.pos)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("bytecode file is truncated at byte %d", d.pos)
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := append([]byte{}, d.data[d.pos:d.pos+n]...)
+	d.pos += n
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	n := d.count()
+	var sm code.SourceMap
+	for i := 0; i < n && d.err == nil; i++ {
+		offset := d.int()
+		pos := token.Position{File: d.string(), Line: d.int(), Column: d.int(), Offset: d.int()}
+		sm = append(sm, code.SourcePos{Offset: offset, Pos: pos})
+	}
+	return sm
+}
+
+func (d *decoder) constant() object.Object {
+	start := d.pos
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: d.varint()}
+	case tagBigInt:
+		sign := d.byte()
+		value := new(big.Int).SetBytes(d.bytes())
+		if sign == 0 {
+			value.Neg(value)
+		}
+		return &object.BigInt{Value: value}
+	case tagFloat:
+		if d.err == nil && len(d.data)-d.pos < 8 {
+			d.fail("bytecode file is truncated at byte %d", d.pos)
+		}
+		if d.err != nil {
+			return nil
+		}
+		bits := binary.BigEndian.Uint64(d.data[d.pos:])
+		d.pos += 8
+		return &object.Float{Value: math.Float64frombits(bits)}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagCompiledFunction:
+		return &object.CompiledFunction{
+			Instructions:  d.bytes(),
+			NumLocals:     d.int(),
+			NumParameters: d.int(),
+			Name:          d.string(),
+			SourceMap:     d.sourceMap(),
+		}
+	default:
+		d.fail("unknown constant tag %d at byte %d", tag, start)
+		return nil
+	}
+}
+
+func sortedKeys(m map[int]string) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
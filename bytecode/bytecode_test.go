@@ -0,0 +1,191 @@
+package bytecode
+
+import (
+	"Monkey/code"
+	"Monkey/compiler"
+	"Monkey/lexer"
+	"Monkey/object"
+	"Monkey/parser"
+	"Monkey/token"
+	"Monkey/vm"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *File {
+	t.Helper()
+	p := parser.New(lexer.NewWithFile(input, "test.mk"))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return &File{Bytecode: comp.Bytecode(), Globals: symbolTable.GlobalNames(), Source: input}
+}
+
+func roundTrip(t *testing.T, f *File) *File {
+	t.Helper()
+	data, err := Encode(f)
+	if err != nil {
+		t.Fatalf("Encode returned error: %s", err)
+	}
+	if !IsBytecode(data) {
+		t.Fatalf("encoded data does not start with %q", Magic)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode returned error: %s", err)
+	}
+	return decoded
+}
+
+func TestRoundTrip(t *testing.T) {
+	input := `let big = 99999999999999999999;
+let add = fn(a, b) { a + b };
+let greet = fn(name) { fn() { "hi " + name } };
+let total = 0;
+for (x in [1, 2.5, 3]) { total += x }
+[add(big, 1), greet("monkey")(), total, len("héllo")];`
+
+	f := compile(t, input)
+	decoded := roundTrip(t, f)
+
+	if !reflect.DeepEqual(decoded, f) {
+		t.Fatalf("decoded file differs.\nwant=%+v\ngot=%+v", f, decoded)
+	}
+
+	// 解码后的字节码与原字节码的运行结果相同
+	for _, bc := range []*compiler.Bytecode{f.Bytecode, decoded.Bytecode} {
+		machine := vm.New(bc)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result := machine.LastPoppedStackElem().Inspect()
+		if result != `[100000000000000000000,hi monkey,6.5,5]` {
+			t.Errorf("wrong result. got=%s", result)
+		}
+	}
+}
+
+func TestConstantEncodings(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	constants := []object.Object{
+		&object.Integer{Value: 0},
+		&object.Integer{Value: math.MinInt64},
+		&object.Integer{Value: math.MaxInt64},
+		&object.BigInt{Value: huge},
+		&object.BigInt{Value: new(big.Int).Neg(huge)},
+		&object.Float{Value: -0.5},
+		&object.Float{Value: math.Inf(1)},
+		&object.String{Value: ""},
+		&object.String{Value: "héllo\x00\n"},
+		&object.CompiledFunction{
+			Instructions:  code.Make(code.OpReturn),
+			NumLocals:     3,
+			NumParameters: 2,
+			Name:          "f",
+			SourceMap:     code.SourceMap{{Offset: 0, Pos: token.Position{File: "a.mk", Line: 3, Column: 7, Offset: 20}}},
+		},
+	}
+	f := &File{
+		Bytecode: &compiler.Bytecode{Instructions: code.Make(code.OpNull), Constants: constants},
+		Globals:  map[int]string{},
+	}
+
+	decoded := roundTrip(t, f)
+	if !reflect.DeepEqual(decoded.Bytecode.Constants, constants) {
+		t.Errorf("wrong constants.\nwant=%+v\ngot=%+v", constants, decoded.Bytecode.Constants)
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	f := &File{Bytecode: &compiler.Bytecode{Constants: []object.Object{&object.Integer{}, &object.Boolean{Value: true}}}}
+
+	_, err := Encode(f)
+	if err == nil || err.Error() != "constant 1: cannot serialize BOOLEAN" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// resign 修改文件内容后重新计算校验和，用于构造校验和正确但内容无效的文件
+func resign(data []byte) []byte {
+	body := data[:len(data)-checksumSize]
+	return binary.BigEndian.AppendUint32(append([]byte{}, body...), crc32.ChecksumIEEE(body))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data, err := Encode(compile(t, `let s = "monkey"; len(s) + 1.5`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(change func(b []byte) []byte) []byte {
+		return change(append([]byte{}, data...))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"not bytecode", []byte("let x = 1;"), "not a Monkey bytecode file"},
+		{"too short", []byte(Magic), "bytecode file is truncated"},
+		{"version", modified(func(b []byte) []byte {
+			binary.BigEndian.PutUint16(b[len(Magic):], Version+1)
+			return resign(b)
+		}), "unsupported bytecode version 2, want 1"},
+		{"checksum", modified(func(b []byte) []byte {
+			b[headerSize+1] ^= 0xff
+			return b
+		}), "checksum mismatch"},
+		{"truncated", modified(func(b []byte) []byte {
+			return resign(b[:len(b)-20])
+		}), "truncated"},
+		{"trailing data", modified(func(b []byte) []byte {
+			return resign(append(b[:len(b)-checksumSize], 0, 0, 0, 0, 0))
+		}), "unexpected data after the end of bytecode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.data)
+			if err == nil {
+				t.Fatalf("expected error containing %q, got nil", tt.expected)
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownConstantTag(t *testing.T) {
+	f := &File{Bytecode: &compiler.Bytecode{Constants: []object.Object{&object.Integer{Value: 1}}}}
+	data, err := Encode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 头部之后依次为空的指令、空的源码映射和常量个数，然后是第一个常量的类型标记
+	tagPos := headerSize + 3
+	if data[tagPos] != tagInteger {
+		t.Fatalf("unexpected layout, byte %d is %d", tagPos, data[tagPos])
+	}
+	data[tagPos] = 99
+
+	_, err = Decode(resign(data))
+	if err == nil || err.Error() != "unknown constant tag 99 at byte 9" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package code
 
 import (
+	"Monkey/token"
 	"bytes"
 	"encoding/binary"
 	"fmt"
@@ -29,6 +30,27 @@ const (
 	OpNull
 	OpSetGlobal
 	OpGetGlobal
+	OpArray
+	OpIndex
+	OpHash
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpClosure
+	OpGetFree
+	OpCurrentClosure
+	OpIter
+	OpIterNext
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpSetIndex
+	OpDup2
+	OpMod
+	OpGreaterThanOrEqual
 )
 
 type Definition struct {
@@ -55,6 +77,36 @@ var definitions = map[Opcode]*Definition{
 	OpNull:          {"OpNull", []int{}},
 	OpSetGlobal:     {"OpSetGlobal", []int{2}},
 	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpArray:         {"OpArray", []int{2}}, // 操作数为数组元素个数
+	OpIndex:         {"OpIndex", []int{}},
+	OpHash:          {"OpHash", []int{2}}, // 操作数为键和值的总个数，即键值对个数的两倍
+	OpCall:          {"OpCall", []int{1}}, // 操作数为实参个数
+	OpReturnValue:   {"OpReturnValue", []int{}},
+	OpReturn:        {"OpReturn", []int{}}, // 函数没有返回值时使用，隐式返回Null
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}}, // 操作数为内置函数在object.Builtins中的下标
+	// 第一个操作数为*object.CompiledFunction在常量池中的下标，第二个操作数为自由变量的个数
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}}, // 获取当前正在执行的闭包，用于递归调用自身
+	OpIter:           {"OpIter", []int{}},           // 弹出可遍历对象，压入它的迭代器
+	// 取栈顶迭代器的下一个元素，依次压入键和值；遍历结束时跳转到操作数位置，迭代器留在栈上
+	OpIterNext: {"OpIterNext", []int{2}},
+	OpSetFree:  {"OpSetFree", []int{1}},
+	// 创建闭包时捕获变量：局部变量槽位中的值先装箱为*object.Cell，压入的是Cell本身
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	OpSetIndex:     {"OpSetIndex", []int{}}, // 依次弹出值、下标和容器，修改容器后压入值
+	OpDup2:         {"OpDup2", []int{}},     // 复制栈顶的两个元素，用于下标的复合赋值
+	OpMod:          {"OpMod", []int{}},
+	// 与OpGreaterThan一样，<=由编译器交换操作数后使用该指令
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+}
+
+// Name 操作码的名称，例如"OpConstant"
+func (def *Definition) Name() string {
+	return def.name
 }
 
 // Lookup 传入opcode的byte
@@ -78,21 +130,21 @@ func Make(op Opcode, operand ...int) []byte {
 		return []byte{}
 	}
 
-	var instruction []byte
-	if len(def.OperandWidths) == 0 {
-		instruction = make([]byte, 1)
-		instruction[0] = byte(op)
-	} else {
-		instructionLen := def.OperandWidths[0] + 1
-		instruction = make([]byte, instructionLen)
-		instruction[0] = byte(op)
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
 	}
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
 	offset := 1
 	for i, o := range operand {
 		with := def.OperandWidths[i]
 		switch with {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += with
 	}
@@ -110,6 +162,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUnit16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 		offset += width
 	}
@@ -122,6 +176,12 @@ func ReadUnit16(ins []byte) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
 
+// ReadUint8 辅助函数
+// 读取单字节操作数
+func ReadUint8(ins []byte) uint8 {
+	return ins[0]
+}
+
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 	i := 0
@@ -129,6 +189,7 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "Error:%s\n", err)
+			i++ // 跳过无法识别的字节，否则会一直停在这里
 			continue
 		}
 
@@ -151,7 +212,30 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.name
 	case 1:
 		return fmt.Sprintf("%s %d", def.name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR:unhandled operandCount for %s\n", def.name)
 }
+
+// SourcePos 记录从Offset开始的指令对应的源码位置
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+}
+
+// SourceMap 指令偏移到源码位置的映射，按Offset递增排列
+type SourceMap []SourcePos
+
+// Lookup 返回偏移为offset的指令对应的源码位置，找不到时返回零值
+func (sm SourceMap) Lookup(offset int) token.Position {
+	var pos token.Position
+	for _, sp := range sm {
+		if sp.Offset > offset {
+			break
+		}
+		pos = sp.Pos
+	}
+	return pos
+}
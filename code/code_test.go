@@ -1,6 +1,9 @@
 package code
 
-import "testing"
+import (
+	"Monkey/token"
+	"testing"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -19,6 +22,13 @@ func TestMake(t *testing.T) {
 		{"OpFalse", OpFalse, []int{}, []byte{byte(OpFalse)}},
 		{"OpMinus", OpMinus, []int{}, []byte{byte(OpMinus)}},
 		{"OpBang", OpBang, []int{}, []byte{byte(OpBang)}},
+		{"OpArray", OpArray, []int{65534}, []byte{byte(OpArray), 255, 254}},
+		{"OpIndex", OpIndex, []int{}, []byte{byte(OpIndex)}},
+		{"OpHash", OpHash, []int{65534}, []byte{byte(OpHash), 255, 254}},
+		{"OpGetLocal", OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{"OpCall", OpCall, []int{2}, []byte{byte(OpCall), 2}},
+		{"OpReturnValue", OpReturnValue, []int{}, []byte{byte(OpReturnValue)}},
+		{"OpClosure", OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
 	}
 
 	for _, tt := range tests {
@@ -48,6 +58,8 @@ func TestReadOperand(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
 	}
 
 	for _, tt := range tests {
@@ -84,6 +96,9 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpFalse),
 		Make(OpBang),
 		Make(OpMinus),
+		Make(OpGetLocal, 1),
+		Make(OpCall, 2),
+		Make(OpClosure, 65535, 255),
 	}
 	expected := `0000 OpConstant 1
 0003 OpConstant 2
@@ -97,6 +112,9 @@ func TestInstructionsString(t *testing.T) {
 0015 OpFalse
 0016 OpBang
 0017 OpMinus
+0018 OpGetLocal 1
+0020 OpCall 2
+0022 OpClosure 65535 255
 `
 	concatted := Instructions{}
 	for _, ins := range instructions {
@@ -107,3 +125,36 @@ func TestInstructionsString(t *testing.T) {
 		t.Fatalf("instruction wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
 	}
 }
+
+func TestSourceMapLookup(t *testing.T) {
+	first := token.Position{Line: 1, Column: 1}
+	second := token.Position{Line: 2, Column: 3}
+	sm := SourceMap{{Offset: 0, Pos: first}, {Offset: 4, Pos: second}}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{-1, token.Position{}},
+		{0, first},
+		{3, first},
+		{4, second},
+		{10, second},
+	}
+
+	for _, tt := range tests {
+		if got := sm.Lookup(tt.offset); got != tt.expected {
+			t.Errorf("Lookup(%d) wrong. want=%+v, got=%+v", tt.offset, tt.expected, got)
+		}
+	}
+}
+
+func TestInstructionsStringUnknownOpcode(t *testing.T) {
+	ins := Instructions{255}
+	ins = append(ins, Make(OpPop)...)
+
+	expected := "Error:opcode 255 undefined\n0001 OpPop\n"
+	if ins.String() != expected {
+		t.Fatalf("instruction wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
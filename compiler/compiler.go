@@ -3,16 +3,22 @@ package compiler
 import (
 	"Monkey/ast"
 	"Monkey/code"
+	"Monkey/diagnostic"
 	"Monkey/object"
+	"Monkey/token"
 	"fmt"
+	"math"
+	"sort"
 )
 
 type Compiler struct {
-	instructions        code.Instructions
-	constants           []object.Object    // 常量池
-	lastInstruction     EmittedInstruction // 最后一条发出的指令
-	previousInstruction EmittedInstruction // 倒数第二条发出的指令
-	symbolTable         *SymbolTable       // 符号表
+	constants   []object.Object // 常量池
+	symbolTable *SymbolTable    // 符号表
+
+	scopes     []CompilationScope // 编译作用域栈，每进入一个函数体就压入一个新的作用域
+	scopeIndex int
+
+	currentPos token.Position // 正在编译的节点的位置，发出的指令都记录这个位置
 }
 
 type EmittedInstruction struct {
@@ -20,11 +26,40 @@ type EmittedInstruction struct {
 	Position int
 }
 
+// CompilationScope 每个函数体拥有独立的指令序列
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction // 最后一条发出的指令
+	previousInstruction EmittedInstruction // 倒数第二条发出的指令
+	sourceMap           code.SourceMap
+	loops               []*loopContext // 正在编译的循环，最内层在最后
+	held                int            // 编译后续子表达式期间留在栈上的中间值个数
+}
+
+// loopContext 记录循环的起始位置和有待回填的break跳转
+type loopContext struct {
+	start  int   // 条件判断的第一条指令，continue跳转到这里
+	breaks []int // break发出的OpJump的位置，循环编译完成后回填为循环之后的位置
+	held   int   // 进入循环体时栈上的中间值个数，break和continue跳转前弹出多出的值
+}
+
 func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
-		symbolTable:  NewSymbolTable(),
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
 	}
 }
 
@@ -35,7 +70,16 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// Compile 编译节点，编译错误为*diagnostic.Diagnostic
 func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil {
+		if pos := node.Pos(); pos.IsValid() {
+			previous := c.currentPos
+			c.currentPos = pos
+			defer func() { c.currentPos = previous }()
+		}
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -51,8 +95,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
 		if err != nil {
@@ -65,23 +115,34 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		}
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if node.Operator == "<" || node.Operator == "<=" {
 			err := c.Compile(node.Right)
 			if err != nil {
 				return err
 			}
+			c.hold(1)
 			err = c.Compile(node.Left)
+			c.hold(-1)
 			if err != nil {
 				return err
 			}
-			c.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterThanOrEqual)
+			}
 			return nil
 		}
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
 		}
+		c.hold(1)
 		err = c.Compile(node.Right)
+		c.hold(-1)
 		if err != nil {
 			return err
 		}
@@ -94,14 +155,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return diagnostic.Errorf(diagnostic.NodeSpan(node), "unknown operator %s", node.Operator)
 		}
 	case *ast.Boolean:
 		if node.Value {
@@ -127,11 +192,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIsPop() {
+		if c.lastInstructionIs(code.OpPop) {
 			c.removeLastPop()
+		} else {
+			// 以语句结尾（或为空）的分支没有值，补一个null保持栈平衡
+			c.emit(code.OpNull)
 		}
 		jumpPos := c.emit(code.OpJump, 9999)
-		afterConsequencePos := len(c.instructions)
+		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
 		if node.Alternative != nil {
 
@@ -139,29 +207,253 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIsPop() {
+			if c.lastInstructionIs(code.OpPop) {
 				c.removeLastPop()
+			} else {
+				c.emit(code.OpNull)
 			}
 		} else {
 			// 设置真正的偏移量
 			c.emit(code.OpNull)
 		}
-		afterAlternativePos := len(c.instructions)
+		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.WhileStatement:
+		loop := &loopContext{start: len(c.currentInstructions()), held: c.scopes[c.scopeIndex].held}
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		scope := &c.scopes[c.scopeIndex]
+		scope.loops = append(scope.loops, loop)
+		err = c.Compile(node.Body)
+		scope = &c.scopes[c.scopeIndex]
+		scope.loops = scope.loops[:len(scope.loops)-1]
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.start)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		for _, pos := range loop.breaks {
+			c.changeOperand(pos, afterLoopPos)
+		}
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIter)
+
+		// 迭代器在整个循环期间留在栈上，结束或break时跳到末尾的OpPop将它弹出
+		loop := &loopContext{start: len(c.currentInstructions()), held: c.scopes[c.scopeIndex].held}
+		iterNextPos := c.emit(code.OpIterNext, 9999)
+		if node.Key != nil {
+			value := c.symbolTable.Define(node.Value.Value)
+			c.storeSymbol(value)
+			key := c.symbolTable.Define(node.Key.Value)
+			c.storeSymbol(key)
+		} else {
+			c.storeSymbol(c.symbolTable.Define(node.Value.Value))
+			c.emit(code.OpPop)
+		}
+
+		scope := &c.scopes[c.scopeIndex]
+		scope.loops = append(scope.loops, loop)
+		err = c.Compile(node.Body)
+		scope = &c.scopes[c.scopeIndex]
+		scope.loops = scope.loops[:len(scope.loops)-1]
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.start)
+
+		cleanupPos := c.emit(code.OpPop)
+		c.changeOperand(iterNextPos, cleanupPos)
+		for _, pos := range loop.breaks {
+			c.changeOperand(pos, cleanupPos)
+		}
+		// 弹出迭代器的OpPop不能被当作表达式语句的OpPop，否则位于函数体或分支末尾时
+		// 会被改写为返回迭代器；补一个值为null的表达式语句，使循环的值与while一致
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+	case *ast.BreakStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		c.popHeld(loop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		c.popHeld(loop)
+		c.emit(code.OpJump, loop.start)
 	case *ast.LetStatement:
+		// 先编译值再定义，使值中引用同名变量时报错而不是读取未赋值的槽位
+		// 函数字面量例外：函数体在调用时才执行，提前定义使函数体内对自身名称的赋值能解析到这个绑定
+		var symbol Symbol
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		symbol := c.symbolTable.Define(node.Name.Value)
-		c.emit(code.OpSetGlobal, symbol.Index)
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		c.storeSymbol(symbol)
 	case *ast.Identifier:
 		name := node.Value
 		symbol, ok := c.symbolTable.Resolve(name)
 		if !ok {
-			return fmt.Errorf("undefined variable: %s", name)
+			return diagnostic.Errorf(diagnostic.NodeSpan(node), "undefined variable: %s", name).
+				WithHint(fmt.Sprintf("define it with `let %s = ...;` before using it", name))
+		}
+		c.loadSymbol(symbol)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-len(node.Elements))
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		c.hold(1)
+		err = c.Compile(node.Index)
+		c.hold(-1)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.HashLiteral:
+		// parser中的Pairs是map，遍历顺序不确定，这里按键在源码中的位置排序，保证生成的指令是确定的
+		// 字符串形式不能作为排序依据：1和"1"的String()相同
+		// 没有位置信息的键（例如直接构造的AST）再按类型和字符串形式排序
+		var keys []ast.Expression
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i], keys[j]
+			if a.Pos().Offset != b.Pos().Offset {
+				return a.Pos().Offset < b.Pos().Offset
+			}
+			if ta, tb := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b); ta != tb {
+				return ta < tb
+			}
+			return a.String() < b.String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			c.hold(1)
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-len(node.Pairs) * 2)
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		// 函数体最后一个表达式的值作为隐式返回值
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		// OpGetLocal等指令的下标和OpClosure的自由变量个数都只有一个字节
+		if numLocals > math.MaxUint8+1 {
+			return diagnostic.Errorf(diagnostic.NodeSpan(node), "too many local variables in function: %d, the limit is %d", numLocals, math.MaxUint8+1)
+		}
+		if len(freeSymbols) > math.MaxUint8 {
+			return diagnostic.Errorf(diagnostic.NodeSpan(node), "too many captured variables in function: %d, the limit is %d", len(freeSymbols), math.MaxUint8)
 		}
-		c.emit(code.OpGetGlobal, symbol.Index)
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
+		instructions := c.leaveScope()
+
+		// 在外层作用域中依次捕获变量，由OpClosure打包进闭包
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			SourceMap:     sourceMap,
+			Name:          node.Name,
+		}
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.CallExpression:
+		// OpCall的实参个数只有一个字节
+		if len(node.Arguments) > math.MaxUint8 {
+			return diagnostic.Errorf(diagnostic.NodeSpan(node), "too many arguments in call: %d, the limit is %d", len(node.Arguments), math.MaxUint8)
+		}
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+		c.hold(1)
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-1 - len(node.Arguments))
+		c.emit(code.OpCall, len(node.Arguments))
 	}
 
 	return nil
@@ -171,12 +463,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap // 顶层指令对应的源码位置
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
@@ -197,47 +491,283 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 }
 
 // addInstruction 辅助函数
-// 用于将指令添加到内存中
+// 用于将指令添加到当前作用域的指令序列中
 func (c *Compiler) addInstruction(inst code.Instructions) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, inst...)
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), inst...)
+	c.addSourcePos(posNewInstruction)
 	return posNewInstruction
 }
 
+// addSourcePos 记录offset处指令的源码位置，与上一条记录相同时不重复记录
+func (c *Compiler) addSourcePos(offset int) {
+	if !c.currentPos.IsValid() {
+		return
+	}
+	sm := c.scopes[c.scopeIndex].sourceMap
+	if len(sm) > 0 && sm[len(sm)-1].Pos == c.currentPos {
+		return
+	}
+	c.scopes[c.scopeIndex].sourceMap = append(sm, code.SourcePos{Offset: offset, Pos: c.currentPos})
+}
+
+// currentInstructions 返回当前作用域的指令序列
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
 // setLastInstruction
 // 设置最后一条发出的指令和倒数第二条发出的指令
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
-	previous := c.lastInstruction
+	previous := c.scopes[c.scopeIndex].lastInstruction
 	last := EmittedInstruction{Opcode: op, Position: pos}
-	c.previousInstruction = previous
-	c.lastInstruction = last
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
 }
 
-// lastInstructionIsPop
-// 辅助函数，用于确认最后一条指令是否为opPop
-func (c *Compiler) lastInstructionIsPop() bool {
-	return c.lastInstruction.Opcode == code.OpPop
+// lastInstructionIs
+// 辅助函数，用于确认当前作用域的最后一条指令是否为op
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
 }
 
 // removeLastPop
 // 用于移除instructions的最后一条指令
 // 并将倒数第二条指令设置为最后一条指令
 func (c *Compiler) removeLastPop() {
-	c.instructions = c.instructions[:c.lastInstruction.Position]
-	c.lastInstruction = c.previousInstruction
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// 丢弃被移除指令的位置记录
+	sm := c.scopes[c.scopeIndex].sourceMap
+	for len(sm) > 0 && sm[len(sm)-1].Offset >= last.Position {
+		sm = sm[:len(sm)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sm
+}
+
+// replaceLastPopWithReturn
+// 将函数体最后一条OpPop替换为OpReturnValue
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
 // changOperand
 // 通过使用新操作数创建指令，从而改变操作数
 func (c *Compiler) changeOperand(opPos int, operand int) {
-	op := code.Opcode(c.instructions[opPos])
+	op := code.Opcode(c.currentInstructions()[opPos])
 	newInstruction := code.Make(op, operand)
 
 	c.replaceInstruction(opPos, newInstruction)
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
 	for i := 0; i < len(newInstruction); i++ {
-		c.instructions[pos+i] = newInstruction[i]
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// enterScope 进入新的编译作用域，同时创建嵌套的符号表
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// leaveScope 离开当前编译作用域，返回该作用域的指令序列
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+// hold 调整当前作用域中留在栈上的中间值个数
+// 表达式的值在编译后续子表达式期间留在栈上，子表达式中的break和continue需要先弹出这些值
+func (c *Compiler) hold(n int) {
+	c.scopes[c.scopeIndex].held += n
+}
+
+// popHeld 弹出进入循环体之后压入栈中的中间值，使跳转后的栈深度与循环开始时一致
+func (c *Compiler) popHeld(loop *loopContext) {
+	for i := loop.held; i < c.scopes[c.scopeIndex].held; i++ {
+		c.emit(code.OpPop)
+	}
+}
+
+// currentLoop 返回当前函数中最内层的循环，break和continue在循环之外时报错
+func (c *Compiler) currentLoop(node ast.Node) (*loopContext, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, diagnostic.Errorf(diagnostic.NodeSpan(node), "%s outside of loop", node.TokenLiteral())
+	}
+	return loops[len(loops)-1], nil
+}
+
+// compileLogicalExpression 用条件跳转实现短路求值，结果总是布尔值
+//
+//	&&: left; JumpNotTruthy F; right; JumpNotTruthy F; True; Jump E; F: False; E:
+//	||: left; Bang; JumpNotTruthy T; right; JumpNotTruthy F; T: True; Jump E; F: False; E:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	if node.Operator == "||" {
+		// 左侧为真时直接得到true
+		c.emit(code.OpBang)
+	}
+	shortCircuitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	rightFalsePos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	truePos := c.emit(code.OpTrue)
+	jumpEndPos := c.emit(code.OpJump, 9999)
+	falsePos := c.emit(code.OpFalse)
+	c.changeOperand(jumpEndPos, len(c.currentInstructions()))
+	c.changeOperand(rightFalsePos, falsePos)
+	if node.Operator == "||" {
+		c.changeOperand(shortCircuitPos, truePos)
+	} else {
+		c.changeOperand(shortCircuitPos, falsePos)
+	}
+	return nil
+}
+
+// compoundOperators 复合赋值运算符对应的运算指令
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+// compileAssignExpression 赋值表达式执行后栈顶留下赋值后的值
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	op, compound := compoundOperators[node.Operator]
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		name := target.Value
+		symbol, ok := c.symbolTable.ResolveBinding(name)
+		if !ok {
+			return diagnostic.Errorf(diagnostic.NodeSpan(target), "cannot assign to undefined variable: %s", name).
+				WithHint(fmt.Sprintf("define it with `let %s = ...;` first", name))
+		}
+		if symbol.Scope == BuiltinScope {
+			return diagnostic.Errorf(diagnostic.NodeSpan(target), "cannot assign to builtin: %s", name)
+		}
+
+		held := 0
+		if compound {
+			c.loadSymbol(symbol)
+			held = 1
+		}
+		c.hold(held)
+		err := c.Compile(node.Value)
+		c.hold(-held)
+		if err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		c.hold(1)
+		err = c.Compile(target.Index)
+		c.hold(-1)
+		if err != nil {
+			return err
+		}
+		// 容器和下标，复合赋值时还有复制后取出的旧值
+		held := 2
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+			held = 3
+		}
+		c.hold(held)
+		err = c.Compile(node.Value)
+		c.hold(-held)
+		if err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+	default:
+		return diagnostic.Errorf(diagnostic.NodeSpan(node), "invalid assignment target: %s", node.Target)
+	}
+	return nil
+}
+
+// storeSymbol 发出将栈顶的值弹出并保存到符号中的指令
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// captureSymbol 创建闭包时压入被捕获的变量
+// 局部变量和自由变量以Cell的形式共享，函数自身的名称直接压入当前闭包
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// loadSymbol 根据符号的作用域发出对应的读取指令
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
 	}
 }
@@ -3,10 +3,14 @@ package compiler
 import (
 	"Monkey/ast"
 	"Monkey/code"
+	"Monkey/diagnostic"
 	"Monkey/lexer"
 	"Monkey/object"
 	"Monkey/parser"
+	"Monkey/token"
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +28,7 @@ func TestIntegerArithmetic(t *testing.T) {
 		{input: `4/2`, expectedConstants: []any{4, 2}, expectedInstructions: []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 1), code.Make(code.OpDiv), code.Make(code.OpPop)}},
 		{input: `3*7`, expectedConstants: []any{3, 7}, expectedInstructions: []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 1), code.Make(code.OpMul), code.Make(code.OpPop)}},
 		{input: `-1`, expectedConstants: []any{1}, expectedInstructions: []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpMinus), code.Make(code.OpPop)}},
+		{input: `1.5*2`, expectedConstants: []any{1.5, 2}, expectedInstructions: []code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 1), code.Make(code.OpMul), code.Make(code.OpPop)}},
 	}
 
 	for _, tt := range tests {
@@ -89,6 +94,312 @@ func TestConditionals(t *testing.T) {
 			// 0015
 			code.Make(code.OpPop),
 		}},
+		{input: `if(true){let x = 1;}`, expectedConstants: []any{1}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpTrue),
+			// 0001
+			code.Make(code.OpJumpNotTruthy, 14),
+			// 0004
+			code.Make(code.OpConstant, 0),
+			// 0007
+			code.Make(code.OpSetGlobal, 0),
+			// 0010
+			code.Make(code.OpNull),
+			// 0011
+			code.Make(code.OpJump, 15),
+			// 0014
+			code.Make(code.OpNull),
+			// 0015
+			code.Make(code.OpPop),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestComparisonAndModulo(t *testing.T) {
+	tests := []compilerTestCase{
+		{input: "1 <= 2", expectedConstants: []any{2, 1}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpGreaterThanOrEqual),
+			code.Make(code.OpPop),
+		}},
+		{input: "1 >= 2", expectedConstants: []any{1, 2}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpGreaterThanOrEqual),
+			code.Make(code.OpPop),
+		}},
+		{input: "7 % 3", expectedConstants: []any{7, 3}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpMod),
+			code.Make(code.OpPop),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{input: `true && false`, expectedConstants: []any{}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpTrue),
+			// 0001
+			code.Make(code.OpJumpNotTruthy, 12),
+			// 0004
+			code.Make(code.OpFalse),
+			// 0005
+			code.Make(code.OpJumpNotTruthy, 12),
+			// 0008
+			code.Make(code.OpTrue),
+			// 0009
+			code.Make(code.OpJump, 13),
+			// 0012
+			code.Make(code.OpFalse),
+			// 0013
+			code.Make(code.OpPop),
+		}},
+		{input: `true || false`, expectedConstants: []any{}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpTrue),
+			// 0001
+			code.Make(code.OpBang),
+			// 0002
+			code.Make(code.OpJumpNotTruthy, 9),
+			// 0005
+			code.Make(code.OpFalse),
+			// 0006
+			code.Make(code.OpJumpNotTruthy, 13),
+			// 0009
+			code.Make(code.OpTrue),
+			// 0010
+			code.Make(code.OpJump, 14),
+			// 0013
+			code.Make(code.OpFalse),
+			// 0014
+			code.Make(code.OpPop),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{input: `while(true){10};`, expectedConstants: []any{10}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpTrue),
+			// 0001
+			code.Make(code.OpJumpNotTruthy, 11),
+			// 0004
+			code.Make(code.OpConstant, 0),
+			// 0007
+			code.Make(code.OpPop),
+			// 0008
+			code.Make(code.OpJump, 0),
+		}},
+		{input: `1;while(false){break;continue;}`, expectedConstants: []any{1}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpConstant, 0),
+			// 0003
+			code.Make(code.OpPop),
+			// 0004
+			code.Make(code.OpFalse),
+			// 0005
+			code.Make(code.OpJumpNotTruthy, 17),
+			// 0008
+			code.Make(code.OpJump, 17),
+			// 0011
+			code.Make(code.OpJump, 4),
+			// 0014
+			code.Make(code.OpJump, 4),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{input: `for(x in [1]){x}`, expectedConstants: []any{1}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpConstant, 0),
+			// 0003
+			code.Make(code.OpArray, 1),
+			// 0006
+			code.Make(code.OpIter),
+			// 0007
+			code.Make(code.OpIterNext, 21),
+			// 0010
+			code.Make(code.OpSetGlobal, 0),
+			// 0013
+			code.Make(code.OpPop),
+			// 0014
+			code.Make(code.OpGetGlobal, 0),
+			// 0017
+			code.Make(code.OpPop),
+			// 0018
+			code.Make(code.OpJump, 7),
+			// 0021
+			code.Make(code.OpPop),
+			// 0022
+			code.Make(code.OpNull),
+			// 0023
+			code.Make(code.OpPop),
+		}},
+		{input: `for(k, v in {}){break;}`, expectedConstants: []any{}, expectedInstructions: []code.Instructions{
+			// 0000
+			code.Make(code.OpHash, 0),
+			// 0003
+			code.Make(code.OpIter),
+			// 0004
+			code.Make(code.OpIterNext, 19),
+			// 0007
+			code.Make(code.OpSetGlobal, 0),
+			// 0010
+			code.Make(code.OpSetGlobal, 1),
+			// 0013
+			code.Make(code.OpJump, 19),
+			// 0016
+			code.Make(code.OpJump, 4),
+			// 0019
+			code.Make(code.OpPop),
+			// 0020
+			code.Make(code.OpNull),
+			// 0021
+			code.Make(code.OpPop),
+		}},
+		// 位于函数体末尾时返回null而不是迭代器
+		{input: `fn() { for(x in []){} }`, expectedConstants: []any{
+			[]code.Instructions{
+				// 0000
+				code.Make(code.OpArray, 0),
+				// 0003
+				code.Make(code.OpIter),
+				// 0004
+				code.Make(code.OpIterNext, 13),
+				// 0007
+				code.Make(code.OpSetLocal, 0),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpJump, 4),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpReturnValue),
+			},
+		}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpClosure, 0, 0),
+			code.Make(code.OpPop),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{input: `let x = 1; x += 2;`, expectedConstants: []any{1, 2}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpAdd),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpPop),
+		}},
+		{input: `let a = []; a[0] *= 3;`, expectedConstants: []any{0, 3}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpArray, 0),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpDup2),
+			code.Make(code.OpIndex),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpMul),
+			code.Make(code.OpSetIndex),
+			code.Make(code.OpPop),
+		}},
+		{input: `fn(a) { fn() { a = 1 } }`, expectedConstants: []any{
+			1,
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetFree, 0),
+				code.Make(code.OpGetFree, 0),
+				code.Make(code.OpReturnValue),
+			},
+			[]code.Instructions{
+				code.Make(code.OpCaptureLocal, 0),
+				code.Make(code.OpClosure, 1, 1),
+				code.Make(code.OpReturnValue),
+			},
+		}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpClosure, 2, 0),
+			code.Make(code.OpPop),
+		}},
+		// 对函数自身名称的赋值修改外层定义该名称的绑定
+		{input: `let f = fn() { f = 1 };`, expectedConstants: []any{
+			1,
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			},
+		}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpClosure, 1, 0),
+			code.Make(code.OpSetGlobal, 0),
+		}},
+		{input: `fn() { let f = fn() { fn() { f = 1 } } }`, expectedConstants: []any{
+			1,
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetFree, 0),
+				code.Make(code.OpGetFree, 0),
+				code.Make(code.OpReturnValue),
+			},
+			[]code.Instructions{
+				code.Make(code.OpCaptureFree, 0),
+				code.Make(code.OpClosure, 1, 1),
+				code.Make(code.OpReturnValue),
+			},
+			[]code.Instructions{
+				code.Make(code.OpCaptureLocal, 0),
+				code.Make(code.OpClosure, 2, 1),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpReturn),
+			},
+		}, expectedInstructions: []code.Instructions{
+			code.Make(code.OpClosure, 3, 0),
+			code.Make(code.OpPop),
+		}},
 	}
 
 	for _, tt := range tests {
@@ -147,7 +458,7 @@ func concatInstructions(instructions []code.Instructions) code.Instructions {
 
 func testConstants(expected []any, actual []object.Object) error {
 	if len(expected) != len(actual) {
-		return fmt.Errorf("")
+		return fmt.Errorf("wrong number of constants. want=%d, got=%d", len(expected), len(actual))
 	}
 
 	for i, constant := range expected {
@@ -157,6 +468,25 @@ func testConstants(expected []any, actual []object.Object) error {
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case float64:
+			result, ok := actual[i].(*object.Float)
+			if !ok || result.Value != constant {
+				return fmt.Errorf("constant %d - not float %g. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case string:
+			err := testStringObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
 		}
 	}
 
@@ -175,6 +505,18 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got =%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+	return nil
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -235,3 +577,761 @@ func TestGlobalLetStatements(t *testing.T) {
 		})
 	}
 }
+
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"monkey"`,
+			expectedConstants: []any{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []any{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3]",
+			expectedConstants: []any{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3 - 4, 5 * 6]",
+			expectedConstants: []any{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1 + 1]",
+			expectedConstants: []any{1, 2, 3, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 键按源码中的顺序发出
+			input:             "{3: 4, 1: 2, 5: 6}",
+			expectedConstants: []any{3, 4, 1, 2, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2 + 3, 4: 5 * 6}",
+			expectedConstants: []any{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+// TestHashLiteralKeyOrderIsDeterministic 1和"1"的字符串形式相同，按字符串排序时顺序会随map遍历变化
+func TestHashLiteralKeyOrderIsDeterministic(t *testing.T) {
+	program := parse(`{1: "a", "1": "b", 2: "c"}`)
+
+	for i := 0; i < 20; i++ {
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := testConstants([]any{1, "a", "1", "b", 2, "c"}, compiler.Bytecode().Constants)
+		if err != nil {
+			t.Fatalf("keys not emitted in source order: %s", err)
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{1: 2}[2 - 1]",
+			expectedConstants: []any{1, 2, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []any{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { 5 + 10 }`,
+			expectedConstants: []any{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { 1; 2 }`,
+			expectedConstants: []any{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	globalSymbolTable := compiler.symbolTable
+
+	compiler.emit(code.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
+	}
+
+	compiler.emit(code.OpSub)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 1 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last := compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != code.OpSub {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, code.OpSub)
+	}
+
+	if compiler.symbolTable.Outer != globalSymbolTable {
+		t.Errorf("compiler did not enclose symbolTable")
+	}
+
+	compiler.leaveScope()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+
+	if compiler.symbolTable != globalSymbolTable {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+	if compiler.symbolTable.Outer != nil {
+		t.Errorf("compiler modified global symbol table incorrectly")
+	}
+
+	compiler.emit(code.OpAdd)
+
+	if len(compiler.scopes[compiler.scopeIndex].instructions) != 2 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.scopes[compiler.scopeIndex].instructions))
+	}
+
+	last = compiler.scopes[compiler.scopeIndex].lastInstruction
+	if last.Opcode != code.OpAdd {
+		t.Errorf("lastInstruction.Opcode wrong. got=%d, want=%d", last.Opcode, code.OpAdd)
+	}
+
+	previous := compiler.scopes[compiler.scopeIndex].previousInstruction
+	if previous.Opcode != code.OpMul {
+		t.Errorf("previousInstruction.Opcode wrong. got=%d, want=%d", previous.Opcode, code.OpMul)
+	}
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { 24 }();`,
+			expectedConstants: []any{
+				24,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let oneArg = fn(a) { a }; oneArg(24);`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let manyArg = fn(a, b, c) { a; b; c }; manyArg(24, 25, 26);`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpReturnValue),
+				},
+				24,
+				25,
+				26,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCall, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestLetStatementScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let num = 55; fn() { num }`,
+			expectedConstants: []any{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { let num = 55; num }`,
+			expectedConstants: []any{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `len([]); push([], 1);`,
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 4),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { fn(b) { a + b } }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { fn(b) { fn(c) { a + b + c } } };`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let countDown = fn(x) { countDown(x - 1); }; countDown(1);`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let wrapper = fn() { let countDown = fn(x) { countDown(x - 1); }; countDown(1); }; wrapper();`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runCompilerTest(t, tt)
+		})
+	}
+}
+
+func TestCompileErrorDiagnostics(t *testing.T) {
+	program := parse("let a = 1;\nfn() { a + b }")
+
+	err := New().Compile(program)
+	if err == nil {
+		t.Fatalf("expected compile error but resulted in none")
+	}
+	d, ok := err.(*diagnostic.Diagnostic)
+	if !ok {
+		t.Fatalf("compile error is not *diagnostic.Diagnostic. got=%T", err)
+	}
+	if d.Message != "undefined variable: b" {
+		t.Errorf("wrong message. got=%q", d.Message)
+	}
+	if d.Span.Start.Line != 2 || d.Span.Start.Column != 12 {
+		t.Errorf("wrong position. got=%s", d.Span.Start)
+	}
+}
+
+func TestAssignCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"y = 1", "cannot assign to undefined variable: y"},
+		{"fn() { z += 1 }", "cannot assign to undefined variable: z"},
+		{"len = 1", "cannot assign to builtin: len"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			err := New().Compile(parse(tt.input))
+			d, ok := err.(*diagnostic.Diagnostic)
+			if !ok {
+				t.Fatalf("expected *diagnostic.Diagnostic. got=%T(%v)", err, err)
+			}
+			if d.Message != tt.expected {
+				t.Errorf("wrong message. want=%q, got=%q", tt.expected, d.Message)
+			}
+		})
+	}
+}
+
+// localName 第i个局部变量的名称，标识符中不能有数字，用字母表示下标
+func localName(i int) string {
+	return fmt.Sprintf("v%c%c", 'a'+i/26, 'a'+i%26)
+}
+
+// localsSource 依次定义n个局部变量
+func localsSource(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "let %s = %d; ", localName(i), i)
+	}
+	return b.String()
+}
+
+// listSource n个用逗号分隔的表达式，item生成第i个
+func listSource(n int, item func(int) string) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = item(i)
+	}
+	return strings.Join(items, ", ")
+}
+
+func TestOperandLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 为空表示应当编译成功
+	}{
+		{"fn() { " + localsSource(256) + "vaa + vjv }", ""},
+		{"fn() { " + localsSource(300) + "vaa + vjw }", "too many local variables in function: 300, the limit is 256"},
+		{"fn(" + listSource(257, localName) + ") { vaa }", "too many local variables in function: 257, the limit is 256"},
+		{"let f = fn() {}; f(" + listSource(255, strconv.Itoa) + ")", ""},
+		{"let f = fn() {}; f(" + listSource(256, strconv.Itoa) + ")", "too many arguments in call: 256, the limit is 255"},
+		{"fn() { " + localsSource(255) + "fn() { [" + listSource(255, localName) + "] } }", ""},
+		{"fn() { " + localsSource(256) + "fn() { [" + listSource(256, localName) + "] } }", "too many captured variables in function: 256, the limit is 255"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := New().Compile(parse(tt.input))
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatalf("compiler error:%s", err)
+				}
+				return
+			}
+			d, ok := err.(*diagnostic.Diagnostic)
+			if !ok {
+				t.Fatalf("expected *diagnostic.Diagnostic. got=%T(%v)", err, err)
+			}
+			if d.Message != tt.expected {
+				t.Errorf("wrong message. want=%q, got=%q", tt.expected, d.Message)
+			}
+		})
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	program := parse("let a = 1;\nlet f = fn(x) {\n  x * a\n};")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error:%s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// 0000 OpConstant 0; 0003 OpSetGlobal 0; 0006 OpClosure 2 0; 0010 OpSetGlobal 1
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 9},
+		{3, 1, 1},
+		{6, 2, 9},
+		{10, 2, 1},
+	}
+	for _, tt := range tests {
+		pos := bytecode.SourceMap.Lookup(tt.offset)
+		if pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("position of offset %d wrong. want=%d:%d, got=%s", tt.offset, tt.line, tt.column, pos)
+		}
+	}
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	// 0000 OpGetLocal 0; 0002 OpGetGlobal 0; 0005 OpMul
+	want := token.Position{Line: 3, Column: 5, Offset: 31}
+	if pos := fn.SourceMap.Lookup(5); pos != want {
+		t.Errorf("position of OpMul wrong. want=%+v, got=%+v", want, pos)
+	}
+}
+
+func TestLetValueCannotReferenceItself(t *testing.T) {
+	tests := []string{
+		"let x = x + 1;",
+		"let f = fn() { let y = y; y };",
+		"let a = [a];",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			err := New().Compile(parse(input))
+			d, ok := err.(*diagnostic.Diagnostic)
+			if !ok {
+				t.Fatalf("expected *diagnostic.Diagnostic. got=%T(%v)", err, err)
+			}
+			if !strings.HasPrefix(d.Message, "undefined variable: ") {
+				t.Errorf("wrong message. got=%q", d.Message)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package compiler
 
+import "sort"
+
 // SymbolScope 作用域使用SymbolScope别名，SymbolScope本身不重要，主要是有唯一性；
 // 使用String是为了方便调式。
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL" //全局作用域
+	GlobalScope   SymbolScope = "GLOBAL"   //全局作用域
+	LocalScope    SymbolScope = "LOCAL"    //局部作用域
+	BuiltinScope  SymbolScope = "BUILTIN"  //内置函数作用域
+	FreeScope     SymbolScope = "FREE"     //自由变量，即闭包捕获的外层局部绑定
+	FunctionScope SymbolScope = "FUNCTION" //当前函数自身的名称，用于递归闭包
 )
 
 type Symbol struct {
@@ -15,8 +21,12 @@ type Symbol struct {
 }
 
 type SymbolTable struct {
+	Outer *SymbolTable // 外层符号表，全局符号表的Outer为nil
+
 	store          map[string]Symbol // string为标识符，可以将标识符和Symbol相关联
 	numDefinitions int
+
+	FreeSymbols []Symbol // 被当前作用域捕获的外层符号，按捕获顺序存放
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -24,18 +34,146 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: s}
 }
 
+// NewEnclosedSymbolTable 创建嵌套在outer中的符号表，用于函数体
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
 // Define 将标识符作为参数
-// 创建定义并返回Symbol
+// 创建定义并返回Symbol，同一作用域中重复定义的名称沿用原来的索引
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+	if existing, ok := s.store[name]; ok && (existing.Scope == GlobalScope || existing.Scope == LocalScope) {
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// Symbols 返回当前符号表中通过Define定义的符号，按索引排序
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// GlobalNames 返回全局变量下标到名称的映射，用于反汇编和字节码文件
+func (s *SymbolTable) GlobalNames() map[int]string {
+	names := map[int]string{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			names[symbol.Index] = symbol.Name
+		}
+	}
+	return names
+}
+
+// Clone 复制当前符号表，在副本中定义符号不会影响原符号表，用于只编译不执行的场合
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	return clone
+}
+
+// DefineBuiltin 定义内置函数，index为内置函数在object.Builtins中的下标
+// 内置函数不占用numDefinitions
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName 定义当前函数自身的名称
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// defineFree 将外层符号记录为自由变量，并返回在当前作用域中的FreeScope符号
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
 // Resolve 将一个定义的标识符交给符号表
-// 返回与其相关的Define
+// 返回与其相关的Define，当前符号表中找不到时到外层符号表中查找
+// 外层的局部绑定和自由变量会被当前作用域捕获为自由变量
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
 	return obj, ok
 }
+
+// ResolveBinding 解析赋值的目标，与Resolve相同，但跳过函数自身的名称，
+// 解析到外层定义该名称的绑定，使赋值修改的是定义该名称的作用域
+// 解析结果会替换当前作用域中的记录，之后读取该名称时也使用外层的绑定
+func (s *SymbolTable) ResolveBinding(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok && !s.isFunctionName(obj) {
+		return obj, true
+	}
+	if s.Outer == nil {
+		return obj, false
+	}
+
+	obj, ok = s.Outer.ResolveBinding(name)
+	if !ok {
+		return obj, ok
+	}
+	if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		s.store[name] = obj
+		return obj, ok
+	}
+	return s.defineFree(obj), true
+}
+
+// isFunctionName 判断符号是否指向函数自身的名称，包括被内层函数捕获的情况
+func (s *SymbolTable) isFunctionName(symbol Symbol) bool {
+	switch symbol.Scope {
+	case FunctionScope:
+		return true
+	case FreeScope:
+		return s.FreeSymbols[symbol.Index].Scope == FunctionScope
+	}
+	return false
+}
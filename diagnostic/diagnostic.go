@@ -0,0 +1,122 @@
+package diagnostic
+
+import (
+	"Monkey/ast"
+	"Monkey/token"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Severity 诊断信息的严重程度
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Span 源码区间，End不包含在区间内
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// 栈帧中使用的特殊函数名
+const (
+	MainFunction      = "<main>"      // 顶层代码
+	AnonymousFunction = "<anonymous>" // 没有通过let绑定名称的函数
+)
+
+// StackFrame 运行时错误发生时调用栈中的一帧
+// Pos为该函数中正在执行的位置：最内层帧为出错位置，外层帧为调用位置
+type StackFrame struct {
+	Function string
+	Pos      token.Position
+}
+
+func (sf StackFrame) String() string {
+	return fmt.Sprintf("%s (%s)", sf.Function, sf.Pos)
+}
+
+// Diagnostic 解析器、编译器和运行时共用的诊断信息
+// 实现了error接口，可以直接作为错误返回
+type Diagnostic struct {
+	Severity Severity
+	Span     Span
+	Message  string
+	Hint     string       // 可选的修改建议
+	Trace    []StackFrame // 运行时错误的调用栈，最内层在前
+}
+
+func New(severity Severity, span Span, message string) *Diagnostic {
+	return &Diagnostic{Severity: severity, Span: span, Message: message}
+}
+
+// Errorf 创建错误级别的诊断信息
+func Errorf(span Span, format string, a ...any) *Diagnostic {
+	return New(Error, span, fmt.Sprintf(format, a...))
+}
+
+// WithHint 设置修改建议并返回自身，便于链式调用
+func (d *Diagnostic) WithHint(hint string) *Diagnostic {
+	d.Hint = hint
+	return d
+}
+
+func (d *Diagnostic) Pos() token.Position {
+	return d.Span.Start
+}
+
+// Error 返回"位置: 信息"格式的单行文本，位置未知时只返回信息
+func (d *Diagnostic) Error() string {
+	if !d.Span.Start.IsValid() {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// PosSpan 以pos为起点、宽度为一个字符的区间
+func PosSpan(pos token.Position) Span {
+	end := pos
+	if end.IsValid() {
+		end.Column++
+		end.Offset++
+	}
+	return Span{Start: pos, End: end}
+}
+
+// TokenSpan 覆盖整个词法单元的区间
+func TokenSpan(tok token.Token) Span {
+	return literalSpan(tok.Pos, tok.Literal)
+}
+
+// NodeSpan 覆盖节点主词法单元的区间
+func NodeSpan(node ast.Node) Span {
+	return literalSpan(node.Pos(), node.TokenLiteral())
+}
+
+func literalSpan(pos token.Position, literal string) Span {
+	if literal == "" {
+		return PosSpan(pos)
+	}
+	end := pos
+	if end.IsValid() {
+		end.Column += utf8.RuneCountInString(literal)
+		end.Offset += len(literal)
+	}
+	return Span{Start: pos, End: end}
+}
@@ -0,0 +1,143 @@
+package diagnostic
+
+import (
+	"Monkey/token"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDiagnosticError(t *testing.T) {
+	tests := []struct {
+		diag     *Diagnostic
+		expected string
+	}{
+		{Errorf(PosSpan(token.Position{File: "a.mk", Line: 3, Column: 7}), "boom %d", 1), "a.mk:3:7: boom 1"},
+		{Errorf(PosSpan(token.Position{Line: 1, Column: 2}), "boom"), "1:2: boom"},
+		{Errorf(Span{}, "boom"), "boom"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.diag.Error(); got != tt.expected {
+			t.Errorf("Error() wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestTokenSpan(t *testing.T) {
+	tok := token.Token{Type: token.IDENT, Literal: "héllo", Pos: token.Position{Line: 2, Column: 4, Offset: 10}}
+
+	span := TokenSpan(tok)
+	want := token.Position{Line: 2, Column: 9, Offset: 16}
+	if span.End != want {
+		t.Errorf("span end wrong. want=%+v, got=%+v", want, span.End)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := "let x = 1;\n\tlet héllo = x + y;\n"
+	start := token.Position{File: "main.mk", Line: 2, Column: 17, Offset: 28}
+	diag := Errorf(TokenSpan(token.Token{Literal: "y", Pos: start}), "undefined variable: y").
+		WithHint("define it first")
+
+	var out bytes.Buffer
+	Render(&out, src, []*Diagnostic{diag})
+
+	expected := "main.mk:2:17: error: undefined variable: y\n" +
+		" 2 | \tlet héllo = x + y;\n" +
+		"   | \t               ^\n" +
+		"   = hint: define it first\n"
+	if out.String() != expected {
+		t.Errorf("Render wrong.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestRenderMultiCharacterSpan(t *testing.T) {
+	src := "foobar + 1"
+	diag := Errorf(TokenSpan(token.Token{Literal: "foobar", Pos: token.Position{Line: 1, Column: 1}}), "bad")
+
+	var out bytes.Buffer
+	Render(&out, src, []*Diagnostic{diag})
+
+	expected := "1:1: error: bad\n 1 | foobar + 1\n   | ^^^^^^\n"
+	if out.String() != expected {
+		t.Errorf("Render wrong.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+	var out bytes.Buffer
+	Render(&out, "", []*Diagnostic{Errorf(Span{}, "stack overflow")})
+
+	if out.String() != "error: stack overflow\n" {
+		t.Errorf("Render wrong. got=%q", out.String())
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	diag := Errorf(PosSpan(token.Position{File: "a.mk", Line: 1, Column: 5, Offset: 4}), "oops").WithHint("fix it")
+
+	var out bytes.Buffer
+	if err := RenderJSON(&out, []*Diagnostic{diag}); err != nil {
+		t.Fatalf("RenderJSON returned error: %s", err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, out.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(decoded))
+	}
+	d := decoded[0]
+	if d["severity"] != "error" || d["message"] != "oops" || d["hint"] != "fix it" {
+		t.Errorf("wrong fields: %+v", d)
+	}
+	start := d["start"].(map[string]any)
+	if start["file"] != "a.mk" || start["line"] != float64(1) || start["column"] != float64(5) {
+		t.Errorf("wrong start position: %+v", start)
+	}
+	end := d["end"].(map[string]any)
+	if end["column"] != float64(6) {
+		t.Errorf("wrong end position: %+v", end)
+	}
+}
+
+func TestRenderStackTrace(t *testing.T) {
+	pos := func(line, col int) token.Position { return token.Position{File: "m.mk", Line: line, Column: col} }
+	diag := Errorf(PosSpan(pos(2, 3)), "boom")
+	diag.Trace = []StackFrame{
+		{Function: "inner", Pos: pos(2, 3)},
+		{Function: MainFunction, Pos: pos(4, 6)},
+	}
+
+	var out bytes.Buffer
+	Render(&out, "let f = fn() {\n  x\n};\nf();\n", []*Diagnostic{diag})
+
+	expected := "m.mk:2:3: error: boom\n" +
+		" 2 |   x\n" +
+		"   |   ^\n" +
+		"stack trace:\n" +
+		"    at inner (m.mk:2:3)\n" +
+		"    at <main> (m.mk:4:6)\n"
+	if out.String() != expected {
+		t.Errorf("Render wrong.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestRenderLongStackTrace(t *testing.T) {
+	diag := Errorf(Span{}, "frame overflow")
+	for i := 0; i < 100; i++ {
+		diag.Trace = append(diag.Trace, StackFrame{Function: "f"})
+	}
+
+	var out bytes.Buffer
+	Render(&out, "", []*Diagnostic{diag})
+
+	if !bytes.Contains(out.Bytes(), []byte("... 80 frames omitted ...")) {
+		t.Errorf("long trace not truncated. got=%q", out.String())
+	}
+	if n := bytes.Count(out.Bytes(), []byte("    at f")); n != maxTraceFrames {
+		t.Errorf("wrong number of frames. want=%d, got=%d", maxTraceFrames, n)
+	}
+}
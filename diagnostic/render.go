@@ -0,0 +1,141 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Render 以文本形式输出诊断信息，src为诊断所在文件的源码
+// 位置有效时会输出出错的源码行，并在出错区间下方画出^标记
+//
+//	main.mk:2:5: error: peekToken want to be [IDENT], but got [=]
+//	   2 | let = 2;
+//	     |     ^
+//	     = hint: ...
+//
+// 调用栈中包含Monkey函数帧时，随后输出调用栈
+func Render(w io.Writer, src string, diags []*Diagnostic) {
+	for _, d := range diags {
+		renderOne(w, src, d)
+	}
+}
+
+func renderOne(w io.Writer, src string, d *Diagnostic) {
+	start := d.Span.Start
+	if start.IsValid() {
+		fmt.Fprintf(w, "%s: %s: %s\n", start, d.Severity, d.Message)
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+	}
+
+	lineText, ok := sourceLine(src, start.Line)
+	gutter := len(fmt.Sprint(start.Line))
+	if start.IsValid() && ok {
+		fmt.Fprintf(w, " %*d | %s\n", gutter, start.Line, lineText)
+		fmt.Fprintf(w, " %*s | %s\n", gutter, "", underline(lineText, d.Span))
+	}
+	if d.Hint != "" {
+		fmt.Fprintf(w, " %*s = hint: %s\n", gutter, "", d.Hint)
+	}
+	renderTrace(w, d.Trace)
+}
+
+// maxTraceFrames 调用栈过深时（例如无限递归）只输出首尾各一半的帧
+const maxTraceFrames = 20
+
+// renderTrace 只有顶层帧时没有额外信息，不输出
+func renderTrace(w io.Writer, trace []StackFrame) {
+	if len(trace) <= 1 {
+		return
+	}
+	io.WriteString(w, "stack trace:\n")
+	for i, frame := range trace {
+		if len(trace) > maxTraceFrames && i == maxTraceFrames/2 {
+			fmt.Fprintf(w, "    ... %d frames omitted ...\n", len(trace)-maxTraceFrames)
+		}
+		if len(trace) > maxTraceFrames && i >= maxTraceFrames/2 && i < len(trace)-maxTraceFrames/2 {
+			continue
+		}
+		fmt.Fprintf(w, "    at %s\n", frame)
+	}
+}
+
+// sourceLine 返回第line行的源码（不含换行符）
+func sourceLine(src string, line int) (string, bool) {
+	if line <= 0 {
+		return "", false
+	}
+	lines := strings.Split(src, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// underline 生成与源码行对齐的^标记，制表符原样保留以保证对齐
+func underline(lineText string, span Span) string {
+	var out strings.Builder
+
+	runes := []rune(lineText)
+	startCol := span.Start.Column
+	for i := 0; i < startCol-1 && i < len(runes); i++ {
+		if runes[i] == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > startCol {
+		width = span.End.Column - startCol
+	}
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
+
+type jsonPosition struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+}
+
+type jsonStackFrame struct {
+	Function string       `json:"function"`
+	Pos      jsonPosition `json:"pos"`
+}
+
+type jsonDiagnostic struct {
+	Severity string           `json:"severity"`
+	Message  string           `json:"message"`
+	Hint     string           `json:"hint,omitempty"`
+	Start    jsonPosition     `json:"start"`
+	End      jsonPosition     `json:"end"`
+	Trace    []jsonStackFrame `json:"trace,omitempty"`
+}
+
+// RenderJSON 以JSON数组形式输出诊断信息，供编辑器集成使用
+func RenderJSON(w io.Writer, diags []*Diagnostic) error {
+	out := make([]jsonDiagnostic, 0, len(diags))
+	for _, d := range diags {
+		jd := jsonDiagnostic{
+			Severity: d.Severity.String(),
+			Message:  d.Message,
+			Hint:     d.Hint,
+			Start:    jsonPosition(d.Span.Start),
+			End:      jsonPosition(d.Span.End),
+		}
+		for _, frame := range d.Trace {
+			jd.Trace = append(jd.Trace, jsonStackFrame{Function: frame.Function, Pos: jsonPosition(frame.Pos)})
+		}
+		out = append(out, jd)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,203 @@
+// Package disasm 把编译器生成的字节码反汇编为便于阅读的文本
+//
+// 与code.Instructions.String相比，反汇编结果按函数分段列出，跳转目标显示为标签，
+// 并在注释中给出常量的值、全局变量和内置函数的名称以及指令对应的源码行
+package disasm
+
+import (
+	"Monkey/code"
+	"Monkey/compiler"
+	"Monkey/diagnostic"
+	"Monkey/object"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options 反汇编时可选的调试信息
+type Options struct {
+	Source  string         // 源码，非空时在指令前标注对应的源码行
+	Globals map[int]string // 全局变量下标到名称的映射，用于标注OpGetGlobal和OpSetGlobal
+}
+
+// jumps 第一个操作数为跳转目标的指令
+var jumps = map[code.Opcode]bool{
+	code.OpJump:          true,
+	code.OpJumpNotTruthy: true,
+	code.OpIterNext:      true,
+}
+
+// Disassemble 先输出顶层指令，再按常量池中的顺序输出每个函数的指令
+func Disassemble(w io.Writer, bytecode *compiler.Bytecode, opts Options) {
+	d := &disassembler{w: w, constants: bytecode.Constants, globals: opts.Globals}
+	if opts.Source != "" {
+		d.lines = strings.Split(opts.Source, "\n")
+	}
+
+	d.function("main", bytecode.Instructions, bytecode.SourceMap)
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintln(w)
+		header := fmt.Sprintf("fn %s (constant %d, params %d, locals %d)",
+			functionName(fn), i, fn.NumParameters, fn.NumLocals)
+		d.function(header, fn.Instructions, fn.SourceMap)
+	}
+}
+
+type disassembler struct {
+	w         io.Writer
+	constants []object.Object
+	globals   map[int]string
+	lines     []string
+}
+
+// instruction 解码后的一条指令，def为nil时err说明无法解码的原因
+type instruction struct {
+	offset   int
+	op       code.Opcode
+	def      *code.Definition
+	operands []int
+	err      string
+}
+
+// decode 把字节码拆分为指令，遇到未定义的操作码时跳过一个字节，操作数不完整时停止
+func decode(ins code.Instructions) []instruction {
+	var decoded []instruction
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			decoded = append(decoded, instruction{offset: i, err: err.Error()})
+			i++
+			continue
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			decoded = append(decoded, instruction{offset: i, err: def.Name() + " truncated"})
+			break
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, instruction{offset: i, op: code.Opcode(ins[i]), def: def, operands: operands})
+		i += 1 + read
+	}
+	return decoded
+}
+
+// jumpLabels 按偏移顺序为所有跳转目标分配标签L0、L1……
+func jumpLabels(decoded []instruction) map[int]string {
+	var targets []int
+	seen := map[int]bool{}
+	for _, ins := range decoded {
+		if ins.def != nil && jumps[ins.op] && !seen[ins.operands[0]] {
+			seen[ins.operands[0]] = true
+			targets = append(targets, ins.operands[0])
+		}
+	}
+	sort.Ints(targets)
+
+	result := make(map[int]string, len(targets))
+	for i, target := range targets {
+		result[target] = fmt.Sprintf("L%d", i)
+	}
+	return result
+}
+
+func (d *disassembler) function(header string, instructions code.Instructions, sourceMap code.SourceMap) {
+	fmt.Fprintf(d.w, "== %s ==\n", header)
+
+	decoded := decode(instructions)
+	labels := jumpLabels(decoded)
+	line, next := 0, 0
+	for _, ins := range decoded {
+		// sourceMap按偏移递增，随指令一起向前推进
+		for next < len(sourceMap) && sourceMap[next].Offset <= ins.offset {
+			if pos := sourceMap[next].Pos; pos.IsValid() && pos.Line != line {
+				line = pos.Line
+				d.sourceLine(line)
+			}
+			next++
+		}
+		if label, ok := labels[ins.offset]; ok {
+			fmt.Fprintf(d.w, "%s:\n", label)
+		}
+		if ins.def == nil {
+			fmt.Fprintf(d.w, "  %04d  error: %s\n", ins.offset, ins.err)
+			continue
+		}
+
+		text, comment := d.format(ins, labels)
+		if comment == "" {
+			fmt.Fprintf(d.w, "  %04d  %s\n", ins.offset, text)
+		} else {
+			fmt.Fprintf(d.w, "  %04d  %-24s ; %s\n", ins.offset, text, comment)
+		}
+	}
+	// 跳转到函数末尾的标签
+	if label, ok := labels[len(instructions)]; ok {
+		fmt.Fprintf(d.w, "%s:\n", label)
+	}
+}
+
+func (d *disassembler) sourceLine(line int) {
+	if line <= len(d.lines) {
+		fmt.Fprintf(d.w, "; %d | %s\n", line, strings.TrimSpace(d.lines[line-1]))
+		return
+	}
+	fmt.Fprintf(d.w, "; line %d\n", line)
+}
+
+// format 返回指令的文本和注释，跳转指令的目标替换为标签
+func (d *disassembler) format(ins instruction, labels map[int]string) (string, string) {
+	parts := []string{ins.def.Name()}
+	for i, operand := range ins.operands {
+		if i == 0 && jumps[ins.op] {
+			parts = append(parts, labels[operand])
+			continue
+		}
+		parts = append(parts, strconv.Itoa(operand))
+	}
+	text := strings.Join(parts, " ")
+
+	switch ins.op {
+	case code.OpConstant, code.OpClosure:
+		return text, d.constant(ins.operands[0])
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return text, d.globals[ins.operands[0]]
+	case code.OpGetBuiltin:
+		if index := ins.operands[0]; index < len(object.Builtins) {
+			return text, object.Builtins[index].Name
+		}
+	}
+	return text, ""
+}
+
+// constant 常量的简短描述：函数显示名称，字符串加上引号，其他类型显示Inspect的结果
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.constants) {
+		return "<invalid constant>"
+	}
+	switch constant := d.constants[index].(type) {
+	case *object.CompiledFunction:
+		return "fn " + functionName(constant)
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return diagnostic.AnonymousFunction
+	}
+	return fn.Name
+}
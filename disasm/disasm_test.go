@@ -0,0 +1,122 @@
+package disasm
+
+import (
+	"Monkey/code"
+	"Monkey/compiler"
+	"Monkey/lexer"
+	"Monkey/object"
+	"Monkey/parser"
+	"bytes"
+	"testing"
+)
+
+func compile(t *testing.T, input string) (*compiler.Bytecode, *compiler.SymbolTable) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode(), symbolTable
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `let greet = fn(name) { "hi " + name };
+if (len(greet("x")) > 3) { 1 } else { 2.5 };`
+
+	expected := `== main ==
+; 1 | let greet = fn(name) { "hi " + name };
+  0000  OpClosure 1 0            ; fn greet
+  0004  OpSetGlobal 0            ; greet
+; 2 | if (len(greet("x")) > 3) { 1 } else { 2.5 };
+  0007  OpGetBuiltin 0           ; len
+  0009  OpGetGlobal 0            ; greet
+  0012  OpConstant 2             ; "x"
+  0015  OpCall 1
+  0017  OpCall 1
+  0019  OpConstant 3             ; 3
+  0022  OpGreaterThan
+  0023  OpJumpNotTruthy L0
+  0026  OpConstant 4             ; 1
+  0029  OpJump L1
+L0:
+  0032  OpConstant 5             ; 2.5
+L1:
+  0035  OpPop
+
+== fn greet (constant 1, params 1, locals 1) ==
+; 1 | let greet = fn(name) { "hi " + name };
+  0000  OpConstant 0             ; "hi "
+  0003  OpGetLocal 0
+  0005  OpAdd
+  0006  OpReturnValue
+`
+	bytecode, symbolTable := compile(t, input)
+	var out bytes.Buffer
+	Disassemble(&out, bytecode, Options{Source: input, Globals: symbolTable.GlobalNames()})
+
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestDisassembleWithoutDebugInfo(t *testing.T) {
+	bytecode, _ := compile(t, "let x = 1;\nx;")
+	var out bytes.Buffer
+	Disassemble(&out, bytecode, Options{})
+
+	expected := `== main ==
+; line 1
+  0000  OpConstant 0             ; 1
+  0003  OpSetGlobal 0
+; line 2
+  0006  OpGetGlobal 0
+  0009  OpPop
+`
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestDisassembleMalformedInstructions(t *testing.T) {
+	instructions := code.Instructions{255}
+	instructions = append(instructions, code.Make(code.OpJump, 7)...)
+	instructions = append(instructions, code.Make(code.OpConstant, 9)...)
+	instructions = append(instructions, byte(code.OpConstant), 0)
+
+	var out bytes.Buffer
+	Disassemble(&out, &compiler.Bytecode{Instructions: instructions}, Options{})
+
+	// 无法识别的操作码、无效的常量下标和不完整的指令都不会导致崩溃
+	expected := `== main ==
+  0000  error: opcode 255 undefined
+  0001  OpJump L0
+  0004  OpConstant 9             ; <invalid constant>
+L0:
+  0007  error: OpConstant truncated
+`
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestDisassembleJumpToEnd(t *testing.T) {
+	instructions := code.Make(code.OpJump, 3)
+
+	var out bytes.Buffer
+	Disassemble(&out, &compiler.Bytecode{Instructions: instructions}, Options{})
+
+	expected := "== main ==\n  0000  OpJump L0\nL0:\n"
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
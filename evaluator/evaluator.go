@@ -2,39 +2,63 @@ package evaluator
 
 import (
 	"Monkey/ast"
+	"Monkey/diagnostic"
 	"Monkey/object"
+	"Monkey/token"
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 )
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	True     = &object.Boolean{Value: true}
+	False    = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Eval 对节点求值，产生的错误会记录最内层出错节点的位置
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+	if errObj, ok := result.(*object.Error); ok && !errObj.Pos.IsValid() && node != nil {
+		errObj.Pos = node.Pos()
+	}
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
@@ -44,47 +68,68 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
+		if val == nil {
+			val = NULL
+		}
 		env.Set(node.Name.Value, val)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Name: node.Name}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		// 实参个数不对时被调函数还没有开始执行，与虚拟机一样在调用处报错，不加入被调函数的帧
+		if fn, ok := function.(*object.Function); ok && len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		result := applyFunction(function, args)
+		if errObj, ok := result.(*object.Error); ok {
+			traceCall(errObj, function, node.Pos())
+		}
+		return result
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elememts := evalExpressions(node.Elements, env)
-		if len(elememts) == 1 && isError(elememts[0]) {
+		if len(elememts) == 1 && isAbrupt(elememts[0]) {
 			return elememts[0]
 		}
 		return &object.Array{Elements: elememts}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
@@ -105,34 +150,144 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
+			traceCall(result, nil, result.Pos)
 			return result
 		}
 	}
 	return result
 }
 
+// traceCall 在错误从函数调用中传出时补充调用栈
+// 调用方在返回之前并不知道自己是哪个函数，所以先追加一个没有函数名的帧记录调用位置，
+// 由外一层的调用（或evalProgram）填上函数名。callee为nil表示已回到顶层
+func traceCall(errObj *object.Error, callee object.Object, callPos token.Position) {
+	fn, ok := callee.(*object.Function)
+	if callee != nil && !ok {
+		// 内置函数没有Monkey帧，出错位置就是调用位置
+		return
+	}
+
+	name := diagnostic.MainFunction
+	if fn != nil {
+		name = fn.Name
+		if name == "" {
+			name = diagnostic.AnonymousFunction
+		}
+	}
+
+	if n := len(errObj.Trace); n > 0 && errObj.Trace[n-1].Function == "" {
+		errObj.Trace[n-1].Function = name
+	} else {
+		errObj.Trace = append(errObj.Trace, diagnostic.StackFrame{Function: name, Pos: errObj.Pos})
+	}
+	if fn != nil {
+		errObj.Trace = append(errObj.Trace, diagnostic.StackFrame{Pos: callPos})
+	}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if val, ok := builtins[node.Value]; ok {
-		return val
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
 	}
 
 	return newError("identifier not found: %s", node.Value)
 }
 
+// evalAssignExpression 修改已有的绑定或数组、哈希表中的元素，复合赋值先按对应的中缀运算求出新值
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		current, ok := env.Get(target.Value)
+		if !ok {
+			if object.GetBuiltinByName(target.Value) != nil {
+				return newError("cannot assign to builtin: %s", target.Value)
+			}
+			return newError("cannot assign to undefined variable: %s", target.Value)
+		}
+		val := evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+		env.Assign(target.Value, val)
+		return val
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		var current object.Object
+		if node.Operator != "=" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if errObj := setIndex(left, index, val); errObj != nil {
+			return errObj
+		}
+		return val
+	default:
+		return newError("invalid assignment target: %s", node.Target)
+	}
+}
+
+// evalAssignedValue 求出赋值右侧的值，复合赋值时与当前值做对应的运算
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isAbrupt(val) || node.Operator == "=" {
+		return val
+	}
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return evalInfixExpression(operator, current, val)
+}
+
+// setIndex 原地修改数组或哈希表中的元素
+func setIndex(left, index, val object.Object) *object.Error {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return nil
+}
+
 func evalBlockStatement(blockStmt *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, stmt := range blockStmt.Statements {
 		result = Eval(stmt, env)
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value
-		case *object.Error:
-			return result
+		// 返回值保持包装，交由外层的evalProgram或applyFunction解包；break和continue交由外层循环处理
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
 		}
 	}
 	return result
@@ -171,17 +326,26 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return object.NegInt(right.Value)
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
 		return evalBooleanInfix(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
@@ -194,22 +358,132 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 
 }
 
+// evalLogicalExpression 短路求值，结果总是布尔值
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Operator == "&&" && !isTruthy(left) {
+		return False
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return True
+	}
+
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
 	switch operator {
 	case "+":
-		return &object.Integer{leftValue + rightValue}
+		return object.AddInt(leftValue, rightValue)
+	case "-":
+		return object.SubInt(leftValue, rightValue)
+	case "*":
+		return object.MulInt(leftValue, rightValue)
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return object.DivInt(leftValue, rightValue)
+	case "%":
+		// math.MinInt64 % -1在Go中结果为0，不会溢出
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftValue % rightValue}
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isInteger(obj object.Object) bool {
+	_, ok := object.AsBigInt(obj)
+	return ok
+}
+
+// evalBigIntegerInfixExpression 至少一侧为大整数时按任意精度运算，结果重新规范化
+// 除法和取余与int64一致，向零取整
+func evalBigIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftValue, _ := object.AsBigInt(left)
+	rightValue, _ := object.AsBigInt(right)
+	switch operator {
+	case "+":
+		return object.NewInteger(new(big.Int).Add(leftValue, rightValue))
 	case "-":
-		return &object.Integer{leftValue - rightValue}
+		return object.NewInteger(new(big.Int).Sub(leftValue, rightValue))
 	case "*":
-		return &object.Integer{leftValue * rightValue}
+		return object.NewInteger(new(big.Int).Mul(leftValue, rightValue))
 	case "/":
-		return &object.Integer{leftValue / rightValue}
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(new(big.Int).Quo(leftValue, rightValue))
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(new(big.Int).Rem(leftValue, rightValue))
+	case ">":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "<":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) >= 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) <= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := object.AsFloat(obj)
+	return ok
+}
+
+// evalFloatInfixExpression 至少一侧为浮点数时，整数先提升为浮点数再运算
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftValue, _ := object.AsFloat(left)
+	rightValue, _ := object.AsFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
 	case "==":
 		return nativeBoolToBooleanObject(leftValue == rightValue)
 	case "!=":
@@ -224,9 +498,9 @@ func evalBooleanInfix(operator string, left object.Object, right object.Object)
 	rightVal := right.(*object.Boolean).Value
 	switch operator {
 	case "==":
-		return &object.Boolean{leftVal == rightVal}
+		return &object.Boolean{Value: leftVal == rightVal}
 	case "!=":
-		return &object.Boolean{leftVal != rightVal}
+		return &object.Boolean{Value: leftVal != rightVal}
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -235,24 +509,97 @@ func evalBooleanInfix(operator string, left object.Object, right object.Object)
 func evalStringInfix(operator string, left object.Object, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	if operator == "+" {
+	// 比较运算按字节逐个比较，即UTF-8编码下的字典序
+	switch operator {
+	case "+":
 		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
-	return newError("unknown operator: %s %s %s", leftVal, operator, rightVal)
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
+	var result object.Object
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		result = Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
+		result = Eval(ie.Alternative, env)
+	}
+	// 以语句结尾（或为空）的分支没有值，与编译器一样使用null
+	if result == nil {
 		return NULL
 	}
+	return result
+}
+
+// evalWhileStatement 循环体与循环所在的环境相同，循环语句本身没有值
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := Eval(ws.Body, env)
+		switch result.(type) {
+		case *object.Break:
+			return nil
+		case *object.ReturnValue, *object.Error:
+			return result
+		}
+	}
+}
+
+// evalForStatement 循环变量绑定在循环所在的环境中
+// 单变量形式绑定元素的值，双变量形式绑定键和值
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	obj := Eval(fs.Iterable, env)
+	if isAbrupt(obj) {
+		return obj
+	}
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", obj.Type())
+	}
+
+	it := iterable.Iterator()
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			return nil
+		}
+		if fs.Key != nil {
+			env.Set(fs.Key.Value, key)
+		}
+		env.Set(fs.Value.Value, value)
+
+		result := Eval(fs.Body, env)
+		switch result.(type) {
+		case *object.Break:
+			return nil
+		case *object.ReturnValue, *object.Error:
+			return result
+		}
+	}
 }
 
 func isTruthy(obj object.Object) bool {
@@ -273,7 +620,7 @@ func evalExpressions(args []ast.Expression, env *object.Environment) []object.Ob
 
 	for _, arg := range args {
 		result := Eval(arg, env)
-		if isError(result) {
+		if isAbrupt(result) {
 			return []object.Object{result}
 		}
 		results = append(results, result)
@@ -287,7 +634,7 @@ func evalHashLiteralExpression(hashLiteral ast.Expression, env *object.Environme
 	pairs := make(map[object.HashKey]object.HashPair)
 	for key, value := range hash.Pairs {
 		keyObj := Eval(key, env)
-		if isError(keyObj) {
+		if isAbrupt(keyObj) {
 			return keyObj
 		}
 		hashKey, ok := keyObj.(object.Hashable)
@@ -295,7 +642,7 @@ func evalHashLiteralExpression(hashLiteral ast.Expression, env *object.Environme
 			return newError("unusable as hash key: %s", keyObj.Type())
 		}
 		valueObj := Eval(value, env)
-		if isError(valueObj) {
+		if isAbrupt(valueObj) {
 			return valueObj
 		}
 		hashed := hashKey.HashKey()
@@ -306,7 +653,7 @@ func evalHashLiteralExpression(hashLiteral ast.Expression, env *object.Environme
 }
 
 func newError(format string, a ...any) *object.Error {
-	return &object.Error{fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -316,14 +663,34 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// isAbrupt 判断求值是否被中断：错误、return、break和continue都要跳过表达式剩余的部分，
+// 原样向外传递，直到被函数调用或循环处理
+func isAbrupt(obj object.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
+	}
+	return false
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
 		extendEnv := extendFunctionEnv(function, args)
 		evaluated := Eval(function.Body, extendEnv)
+		// 函数体以语句结尾时没有值，与虚拟机一致返回null
+		if evaluated == nil {
+			return NULL
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return function.Fn(args...)
+		// 内置函数返回nil表示没有返回值
+		if result := function.Fn(args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -350,6 +717,8 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -357,6 +726,15 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	}
 }
 
+// evalStringIndexExpression 按字符（rune）下标取值，越界时返回NULL
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+	return char
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -16,6 +16,9 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"10", 10},
 		{"-5", -5},
 		{"-10", -10},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"10 % 5 + 2 * 3 % 4", 2},
 	}
 
 	for _, tt := range tests {
@@ -26,6 +29,117 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500.0},
+		{"-1.5", -1.5},
+		{"1.5 + 2", 3.5},
+		{"2 * 1.25", 2.5},
+		{"1 / 2.0", 0.5},
+		{"7.5 % 2", 1.5},
+		{"0.1 + 0.2 - 0.3 < 1e-15", true},
+		{"1 == 1.0", true},
+		{"2.5 > 2", true},
+		{"2 >= 2.5", false},
+		{"float(2)", 2.0},
+		{"float(\"1.5e3\")", 1500.0},
+		{"int(-3.9)", -3},
+		{"int(3.9)", 3},
+		{"int(\"42\")", 42},
+		{"int(7)", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			}
+		})
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"2.0", "2.0"},
+		{"1e-9", "1e-09"},
+		{"1e21", "1e+21"},
+		{"-0.5", "-0.5"},
+		{"1 / 0.0", "+Inf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+}
+
+func TestEvalBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any // 字符串表示期望得到大整数
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-9223372036854775807 * -2", "18446744073709551614"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001"},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"(9223372036854775807 + 1) / 2", 4611686018427387904},
+		{"-99999999999999999999 % 7", -1},
+		{"9223372036854775807 + 1 > 9223372036854775807", true},
+		{"99999999999999999999 == 99999999999999999998 + 1", true},
+		{"99999999999999999999 != 1", true},
+		{"let h = {99999999999999999999: 1}; h[99999999999999999998 + 1]", 1},
+		{"99999999999999999999 * 1.0", 1e20},
+		{"int(\"99999999999999999999\")", "99999999999999999999"},
+		{"int(1e20)", "100000000000000000000"},
+		{"float(99999999999999999999)", 1e20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case string:
+				result, ok := evaluated.(*object.BigInt)
+				if !ok {
+					t.Fatalf("want got *object.BigInt.but got [%v]", evaluated)
+				}
+				if result.Value.String() != expected {
+					t.Fatalf("want get [%v], but got [%v]", expected, result.Value)
+				}
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			}
+		})
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -33,6 +147,22 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}{
 		{"true", true},
 		{"false", false},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"3 >= 2", true},
+		{"1 + 1 >= 2 == true", true},
+		{"\"a\" < \"b\"", true},
+		{"\"b\" < \"a\"", false},
+		{"\"abc\" > \"abd\"", false},
+		{"\"ab\" < \"abc\"", true},
+		{"\"Z\" < \"a\"", true},
+		{"\"b\" >= \"b\"", true},
+		{"\"a\" <= \"B\"", false},
+		{"\"mon\" + \"key\" == \"monkey\"", true},
+		{"\"a\" != \"a\"", false},
 	}
 
 	for _, tt := range tests {
@@ -144,6 +274,18 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Fatalf("want got *object.Float.but got [%v]", obj)
+	}
+	if result.Value != expected {
+		t.Fatalf("want get [%v], but got [%v]", expected, result.Value)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -181,6 +323,32 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || false", false},
+		{"false || true", true},
+		{"true || false", true},
+		{"1 && \"a\"", true},
+		{"1 > 2 || 3 > 2 && 2 > 1", true},
+		{"false && [][0]()", false},
+		{"true || [][0]()", true},
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n == 0", true},
+		{"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n == 2", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -191,6 +359,7 @@ func TestReturnStatements(t *testing.T) {
 		{"return 2 * 5; 9;", 10},
 		{"9; return 2 * 5; 9;", 10},
 		{`if (10>1){if(10>1){return 10;}return 1;}`, 10},
+		{"let f = fn(x) { 1 + if (x) { return 10; } else { 2 } }; f(true)", 10},
 	}
 
 	for _, tt := range tests {
@@ -243,6 +412,9 @@ if (10 > 1) {
 			"unknown operator: BOOLEAN + BOOLEAN",
 		},
 		{"foobar", "identifier not found: foobar"},
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"let f = fn(a, b) { a }; f(1)", "wrong number of arguments: want=2, got=1"},
 	}
 
 	for _, tt := range tests {
@@ -264,6 +436,118 @@ if (10 > 1) {
 	}
 }
 
+func TestArithmeticFaults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"let x = 0; 10 / x", "division by zero"},
+		{"let x = 10; x /= 0", "division by zero"},
+		{"let f = fn(a, b) { a % b }; f(7, 0)", "division by zero"},
+		{"99999999999999999999 / 0", "division by zero"},
+		{"99999999999999999999 % (1 - 1)", "division by zero"},
+		{"let a = [1]; a[0] /= 0", "division by zero"},
+		{"let total = 0; for (i in range(-2, 3)) { total = total + 10 / i }", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		})
+	}
+}
+
+// TestArithmeticEdgeCases 溢出的运算提升为大整数而不是报错或回绕
+func TestArithmeticEdgeCases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any // 字符串表示期望得到大整数
+	}{
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) % -1", 0},
+		{"(-9223372036854775807 - 1) * -1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1) / 2", 4611686018427387904},
+		{"-7 / 2", -3},
+		{"-7 % 2", -1},
+		{"1 / 0.0 > 99999999999999999999", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case string:
+				if evaluated.Type() != object.BIG_INTEGER_OBJ || evaluated.Inspect() != expected {
+					t.Fatalf("want get BIG_INTEGER [%v], but got %s [%v]", expected, evaluated.Type(), evaluated.Inspect())
+				}
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			}
+		})
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+  x + true
+};
+let outer = fn(y) { inner(y) };
+let wrap = fn(f) { f() };
+wrap(fn() { outer(1) });`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+
+	expected := []string{"inner (2:5)", "outer (4:26)", "<anonymous> (6:18)", "wrap (5:21)", "<main> (6:5)"}
+	if len(errObj.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d (%v)", len(expected), len(errObj.Trace), errObj.Trace)
+	}
+	for i, frame := range errObj.Trace {
+		if frame.String() != expected[i] {
+			t.Errorf("frame %d wrong. want=%q, got=%q", i, expected[i], frame.String())
+		}
+	}
+}
+
+// TestWrongArgumentCountTrace 实参个数不对时被调函数没有执行，调用栈中不应有它的帧
+func TestWrongArgumentCountTrace(t *testing.T) {
+	input := `let f = fn(x) { x };
+let g = fn() { f(1, 2) };
+g();`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned.")
+	}
+	if errObj.Message != "wrong number of arguments: want=1, got=2" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	expected := []string{"g (2:17)", "<main> (3:2)"}
+	if len(errObj.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d (%v)", len(expected), len(errObj.Trace), errObj.Trace)
+	}
+	for i, frame := range errObj.Trace {
+		if frame.String() != expected[i] {
+			t.Errorf("frame %d wrong. want=%q, got=%q", i, expected[i], frame.String())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -340,6 +624,135 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 
 // evaluator/evaluator_test.go
 
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1; }; i", 10},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 3) { continue; } let s = s + i; }; s", 12},
+		{"let i = 0; let n = 0; while (i < 3) { let i = i + 1; let j = 0; while (true) { let j = j + 1; if (j > 2) { break; } let n = n + 1; } }; n", 6},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 7) { return i; } } }; f()", 7},
+		{"let i = 0; while (i < 100000) { let i = i + 1; }; i", 100000},
+		{"let f = fn() { let i = 0; while (i < 3) { let i = i + 1; if (true) { let k = i; } } i }; f()", 3},
+		{"let i = 0; while (i < 5000) { i += 1; let y = 1 + if (i > 0) { continue; } else { 0 }; }; i", 5000},
+		{"let i = 0; let r = 0; while (true) { i += 1; r = [i, if (i == 3) { break; } else { i }][1]; }; r", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+		{"let s = 0; for (i, x in [10, 20, 30]) { let s = s + i * x; }; s", 80},
+		{"let s = 0; for (k, v in {3: 1, 1: 2, 2: 3}) { let s = s * 10 + v; }; s", 231},
+		{"let s = 0; for (k in {1: 5, 2: 6}) { let s = s + k; }; s", 11},
+		{"let n = 0; for (i, c in \"héllo\") { let n = n + i; }; n", 10},
+		{"let s = 0; for (x in range(5)) { if (x == 1) { continue; } if (x == 4) { break; } let s = s + x; }; s", 5},
+		{"let s = 0; for (x in range(10, 0, -3)) { let s = s + x; }; s", 22},
+		{"let f = fn() { for (x in range(1, 100)) { if (x * x > 50) { return x; } } }; f()", 8},
+		{"let s = 0; for (x in range(3)) { for (y in range(3)) { if (y > x) { break; } let s = s + 1; } }; s", 6},
+		// 表达式中的break和continue与错误一样中断表达式的求值，交由循环处理
+		{"let s = 0; for (x in [1, 2, 3]) { let y = 1 + if (x == 1) { continue; } else { x }; s += y; }; s", 7},
+		{"let r = 0; for (n in range(1, 6)) { let r = if (n == 2) { break; } else { n }; }; r", 1},
+		{"let s = 0; for (x in [1, 2, 3]) { s += len([x, if (x == 2) { break; } else { x }]); }; s", 2},
+		{"let a = [0]; for (x in [1, 2, 3]) { a[0] += {x: if (x == 2) { continue; } else { x }}[x]; }; a[0]", 4},
+		{"let f = fn(a, b) { a + b }; let s = 0; for (x in range(3)) { s = s + f(x, if (x == 1) { continue; } else { 10 }); }; s", 22},
+		{"let s = 0; for (x in [1, 2]) { s += -if (x == 1) { continue; } else { x }; }; s", -2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+// TestLoopsInValuePosition 循环语句没有值，出现在需要值的位置时为null
+func TestLoopsInValuePosition(t *testing.T) {
+	tests := []string{
+		"let r = if (true) { while (false) {} }; r",
+		"let r = if (false) { 1 } else { for (x in [1]) {} }; r",
+		"if (true) { for (x in [1]) { x } }",
+		"let r = if (true) {}; r",
+		"fn() { for (x in [1]) {} }()",
+		"let f = fn() { while (false) {} }; let r = f(); r",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			testNullObject(t, testEval(input))
+		})
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let a = 1; let b = 2; a = b = 7; a + b", 14},
+		{"let x = 1; let f = fn() { x = 9; }; f(); x", 9},
+		{"let f = fn() { let x = 1; let g = fn() { x += 2; }; g(); g(); x }; f()", 5},
+		{"let counter = fn() { let c = 0; fn() { c += 1 } }; let inc = counter(); inc(); inc(); inc()", 3},
+		{"let c = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }(); c[0](); c[0](); c[1]()", 2},
+		{"let f = fn(n) { let g = fn() { let h = fn() { n *= 3; }; h(); }; g(); n }; f(2)", 6},
+		{"let i = 0; let s = 0; while (i < 5) { i += 1; s += i; }; s", 15},
+		{"let arr = [1, 2, 3]; arr[0] = 10; arr[2] *= 3; arr[0] + arr[1] + arr[2]", 21},
+		{"let h = {\"a\": 1}; h[\"a\"] += 4; h[\"b\"] = 2; h[\"a\"] + h[\"b\"]", 7},
+		{"let arr = [0]; let f = fn(a) { a[0] = 42; }; f(arr); arr[0]", 42},
+		{"let f = fn(x) { x = x * 2; x }; f(4)", 8},
+		{"let f = fn() { f = 2; }; f(); f", 2},
+		{"let f = fn() { f = 2; f }; f()", 2},
+		{"let f = fn() { let g = fn() { f = 5; }; g(); 1 }; f(); f", 5},
+		{"let outer = fn() { let f = fn() { let g = fn() { f = 5; }; g(); 1 }; f(); f }; outer()", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"y = 1", "cannot assign to undefined variable: y"},
+		{"len = 1", "cannot assign to builtin: len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{"let a = [1]; a[\"x\"] = 2", "array index must be INTEGER, got STRING"},
+		{"let s = \"ab\"; s[0] = \"c\"", "index assignment not supported: STRING"},
+		{"let h = {}; h[fn() {}] = 1", "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			errObj, ok := testEval(tt.input).(*object.Error)
+			if !ok {
+				t.Fatalf("no error object returned.")
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+			}
+		})
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -354,6 +767,50 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"tab\there"`, "tab\there"},
+		{`"say \"hi\""`, "say \"hi\""},
+		{`"back\\slash"`, "back\\slash"},
+		{`"caf\u00e9"`, "café"},
+		{`"\u{1F600}"`, "😀"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`let s = "😀x"; s[1]`, "x"},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`len("\u{1F600}")`, 1},
+		{`"héllo"[5]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case string:
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+				}
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case nil:
+				if evaluated != NULL {
+					t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+				}
+			}
+		})
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -364,6 +821,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`range(0, 5, 0)`, "`range` step must not be zero"},
+		{`for (x in 1) { x }`, "cannot iterate over INTEGER"},
+		{`int("1.5")`, "could not parse \"1.5\" as INTEGER"},
+		{`int(1 / 0.0)`, "cannot convert +Inf to INTEGER"},
+		{`float("abc")`, "could not parse \"abc\" as FLOAT"},
+		{`float([])`, "argument to `float` not supported, got ARRAY"},
 	}
 
 	for _, tt := range tests {
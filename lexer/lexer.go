@@ -2,6 +2,10 @@ package lexer
 
 import (
 	"Monkey/token"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 type Lexer struct {
@@ -9,27 +13,84 @@ type Lexer struct {
 	readPosition int
 	position     int
 	ch           byte
+
+	file   string // 源文件名，仅用于位置信息
+	line   int    // 当前字符所在行
+	column int    // 当前字符所在列
+
+	keepComments bool            // 是否记录跳过的注释
+	comments     []token.Comment // 按出现顺序记录的注释
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile(input, "")
+}
+
+// NewWithFile 创建词法分析器，产生的词法单元位置中带有文件名
+func NewWithFile(input string, file string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// KeepComments 开启后跳过的注释会被记录下来，可以通过Comments获取
+// 注释不会作为词法单元返回，因此不影响语法分析
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
+}
+
+// Comments 返回到目前为止读到的注释，需要先调用KeepComments
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
+}
+
+// skipShebang 跳过脚本第一行的#!解释器声明，使脚本可以直接执行
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peakChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
+	if l.readPosition > len(l.input) {
+		// 已经到达输入末尾，位置不再变化
+		l.ch = 0
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	if l.readPosition == len(l.input) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
 	}
 	l.position = l.readPosition
 	l.readPosition += 1
+
+	// UTF-8多字节字符只在首字节处计列
+	if l.ch&0xC0 != 0x80 {
+		l.column++
+	}
+}
+
+// currentPos 返回当前字符的位置
+func (l *Lexer) currentPos() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.column, Offset: l.position}
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
+	if errTok := l.skipTrivia(); errTok != nil {
+		return *errTok
+	}
+	pos := l.currentPos()
 	switch l.ch {
 	case '=':
 		if l.peakChar() == '=' {
@@ -39,7 +100,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.Token{Type: token.ASSIGN, Literal: string(l.ch)}
 		}
 	case '+':
-		tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
+		tok = l.readOperator(token.PLUS, token.PLUS_ASSIGN)
 	case '(':
 		tok = token.Token{Type: token.LPAREN, Literal: string(l.ch)}
 	case ')':
@@ -53,15 +114,17 @@ func (l *Lexer) NextToken() token.Token {
 	case ';':
 		tok = token.Token{Type: token.SEMICOLON, Literal: string(l.ch)}
 	case '-':
-		tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
+		tok = l.readOperator(token.MINUS, token.MINUS_ASSIGN)
 	case '/':
-		tok = token.Token{Type: token.SLASH, Literal: string(l.ch)}
+		tok = l.readOperator(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
+		tok = l.readOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
 	case '<':
-		tok = token.Token{Type: token.LT, Literal: string(l.ch)}
+		tok = l.readOperator(token.LT, token.LT_EQ)
 	case '>':
-		tok = token.Token{Type: token.GT, Literal: string(l.ch)}
+		tok = l.readOperator(token.GT, token.GT_EQ)
+	case '%':
+		tok = token.Token{Type: token.PERCENT, Literal: string(l.ch)}
 	case '!':
 		if l.peakChar() == '=' {
 			l.readChar()
@@ -69,9 +132,14 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = token.Token{Type: token.BANG, Literal: string(l.ch)}
 		}
+	case '&':
+		tok = l.readDoubleOperator(token.AND)
+	case '|':
+		tok = l.readDoubleOperator(token.OR)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readString(pos)
+		l.readChar()
+		return tok
 	case '[':
 		tok = token.Token{Type: token.LBARACKET, Literal: string(l.ch)}
 	case ']':
@@ -99,34 +167,129 @@ func (l *Lexer) NextToken() token.Token {
 			default:
 				tok.Type = token.LoopupIdent(tok.Literal)
 			}
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
-			return tok
 		}
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
+// readOperator 读取单字符运算符，后面紧跟'='时读取对应的双字符运算符（复合赋值、<=、>=）
+func (l *Lexer) readOperator(single token.TokenType, assign token.TokenType) token.Token {
+	if l.peakChar() == '=' {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: assign, Literal: string(ch) + "="}
+	}
+	return token.Token{Type: single, Literal: string(l.ch)}
+}
+
+// readDoubleOperator 读取由两个相同字符组成的运算符，单独出现时为非法字符
+func (l *Lexer) readDoubleOperator(typ token.TokenType) token.Token {
+	if l.peakChar() == l.ch {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: typ, Literal: string(ch) + string(ch)}
+	}
+	return newToken(token.ILLEGAL, l.ch)
+}
+
 func newToken(typ token.TokenType, ch byte) token.Token {
 	return token.Token{Type: typ, Literal: string(ch)}
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readString 读取字符串字面量，Literal为处理转义后的值
+// 未闭合的字符串和非法的转义序列得到ERROR词法单元；遇到非法转义时仍然读到字符串结尾，避免后续的词法单元错位
+func (l *Lexer) readString(start token.Position) token.Token {
+	var out strings.Builder
+	var errTok *token.Token
+
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch {
+		case l.ch == '"':
+			if errTok != nil {
+				return *errTok
+			}
+			return token.Token{Type: token.STRING, Literal: out.String(), Pos: start}
+		case l.atEOF():
+			return token.Token{Type: token.ERROR, Literal: "unterminated string", Pos: start}
+		case l.ch == '\\':
+			escPos := l.currentPos()
+			l.readChar()
+			if msg := l.readEscape(&out); msg != "" && errTok == nil {
+				errTok = &token.Token{Type: token.ERROR, Literal: msg, Pos: escPos}
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// escapes 单字符转义序列
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+}
+
+// readEscape 当前字符为反斜杠后的第一个字符，把转义得到的字符写入out
+// 支持\n \t \r \0 \\ \"以及\uXXXX、\u{X...}形式的Unicode码点，出错时返回错误信息
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	if ch, ok := escapes[l.ch]; ok {
+		out.WriteByte(ch)
+		return ""
+	}
+	if l.ch != 'u' {
+		if l.atEOF() {
+			return "" // 反斜杠位于输入末尾，由readString报告未闭合
+		}
+		return fmt.Sprintf("unknown escape sequence: \\%c", l.ch)
+	}
+
+	var digits string
+	if l.peakChar() == '{' {
+		l.readChar()
+		for isHexDigit(l.peakChar()) && len(digits) < 6 {
+			l.readChar()
+			digits += string(l.ch)
+		}
+		if l.peakChar() != '}' || digits == "" {
+			return "invalid unicode escape: expected \\u{X} with 1 to 6 hex digits"
+		}
+		l.readChar()
+	} else {
+		for i := 0; i < 4 && isHexDigit(l.peakChar()); i++ {
+			l.readChar()
+			digits += string(l.ch)
+		}
+		if len(digits) != 4 {
+			return "invalid unicode escape: expected \\uXXXX with 4 hex digits"
 		}
 	}
-	return l.input[position:l.position]
+
+	code, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(code)) {
+		return fmt.Sprintf("invalid unicode code point: U+%04X", code)
+	}
+	out.WriteRune(rune(code))
+	return ""
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -147,16 +310,98 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipTrivia 跳过空白和注释，块注释未闭合时返回ERROR词法单元
+func (l *Lexer) skipTrivia() *token.Token {
+	l.skipWhitespace()
+	for l.ch == '/' && (l.peakChar() == '/' || l.peakChar() == '*') {
+		pos := l.currentPos()
+		block := l.peakChar() == '*'
+		var closed bool
+		if block {
+			closed = l.skipBlockComment()
+		} else {
+			l.skipLineComment()
+			closed = true
+		}
+		if !closed {
+			return &token.Token{Type: token.ERROR, Literal: "unterminated block comment", Pos: pos}
+		}
+		if l.keepComments {
+			l.comments = append(l.comments, token.Comment{Text: l.input[pos.Offset:l.position], Pos: pos, Block: block})
+		}
+		l.skipWhitespace()
+	}
+	return nil
+}
+
+// skipLineComment 跳过//到行尾的内容，停在换行符上
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && !l.atEOF() {
+		l.readChar()
+	}
+}
+
+// skipBlockComment 跳过/* */块注释（不支持嵌套），停在结尾的*/之后，未闭合时返回false
+func (l *Lexer) skipBlockComment() bool {
+	l.readChar()
+	l.readChar()
+	for !l.atEOF() {
+		if l.ch == '*' && l.peakChar() == '/' {
+			l.readChar()
+			l.readChar()
+			return true
+		}
+		l.readChar()
+	}
+	return false
+}
+
+// atEOF 是否已经读完输入，输入中的NUL字符不算结束
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber 读取整数或浮点数字面量
+// 小数点和指数部分后面必须紧跟数字，否则不属于这个数字，如"1."读取为整数1
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
+	typ := token.TokenType(token.INT)
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peakChar()) {
+		typ = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		typ = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+	return typ, l.input[position:l.position]
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+}
+
+// isExponent 当前字符为e或E时，判断后面是否为合法的指数部分：可选的正负号加上至少一位数字
+func (l *Lexer) isExponent() bool {
+	next := l.readPosition
+	if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+		next++
+	}
+	return next < len(l.input) && isDigit(l.input[next])
 }
 
 func (l *Lexer) peakChar() byte {
@@ -7,7 +7,7 @@ import (
 )
 
 func Test_Simple_Lexer(t *testing.T) {
-	input := "=+(){},;-/*<>!"
+	input := "=+(){},;-/ *<>!" // "/*"会被当作块注释的开始
 
 	tests := []struct {
 		expectType    token.TokenType
@@ -161,3 +161,344 @@ return false;
 	}
 
 }
+
+func Test_Shebang_Lexer(t *testing.T) {
+	input := "#!/usr/bin/env monkey run\nlet x = 1;"
+
+	tests := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{expectType: token.LET, expectLiteral: "let"},
+		{expectType: token.IDENT, expectLiteral: "x"},
+		{expectType: token.ASSIGN, expectLiteral: "="},
+		{expectType: token.INT, expectLiteral: "1"},
+		{expectType: token.SEMICOLON, expectLiteral: ";"},
+		{expectType: token.EOF, expectLiteral: ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType {
+			t.Fatalf("tests[%d]-token wrong.expected=%q, got=%q", i, tt.expectType, tok.Type)
+		}
+		if tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d]-literal wrong.expected=%q, got=%q", i, tt.expectLiteral, tok.Literal)
+		}
+	}
+}
+
+func Test_Position_Lexer(t *testing.T) {
+	input := "let x = 5;\n  \"é\" + y\n"
+
+	tests := []struct {
+		expectType   token.TokenType
+		expectLine   int
+		expectColumn int
+		expectOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSIGN, 1, 7, 6},
+		{token.INT, 1, 9, 8},
+		{token.SEMICOLON, 1, 10, 9},
+		{token.STRING, 2, 3, 13},
+		{token.PLUS, 2, 7, 18},
+		{token.IDENT, 2, 9, 20},
+		{token.EOF, 3, 1, 22},
+		{token.EOF, 3, 1, 22},
+	}
+
+	l := lexer.NewWithFile(input, "test.mk")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType {
+			t.Fatalf("tests[%d]-token wrong.expected=%q, got=%q", i, tt.expectType, tok.Type)
+		}
+		want := token.Position{File: "test.mk", Line: tt.expectLine, Column: tt.expectColumn, Offset: tt.expectOffset}
+		if tok.Pos != want {
+			t.Fatalf("tests[%d]-position wrong.expected=%+v, got=%+v", i, want, tok.Pos)
+		}
+	}
+}
+
+func Test_Illegal_Lexer(t *testing.T) {
+	l := lexer.New("@1")
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "@" {
+		t.Fatalf("expected ILLEGAL @, got %q %q", tok.Type, tok.Literal)
+	}
+	tok = l.NextToken()
+	if tok.Type != token.INT || tok.Literal != "1" {
+		t.Fatalf("expected INT 1 after illegal character, got %q %q", tok.Type, tok.Literal)
+	}
+}
+
+func Test_Loop_Keywords_Lexer(t *testing.T) {
+	input := "while (x) { break; continue; } for in"
+
+	tests := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{expectType: token.WHILE, expectLiteral: "while"},
+		{expectType: token.LPAREN, expectLiteral: "("},
+		{expectType: token.IDENT, expectLiteral: "x"},
+		{expectType: token.RPAREN, expectLiteral: ")"},
+		{expectType: token.LBRACE, expectLiteral: "{"},
+		{expectType: token.BREAK, expectLiteral: "break"},
+		{expectType: token.SEMICOLON, expectLiteral: ";"},
+		{expectType: token.CONTINUE, expectLiteral: "continue"},
+		{expectType: token.SEMICOLON, expectLiteral: ";"},
+		{expectType: token.RBRACE, expectLiteral: "}"},
+		{expectType: token.FOR, expectLiteral: "for"},
+		{expectType: token.IN, expectLiteral: "in"},
+		{expectType: token.EOF, expectLiteral: ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType {
+			t.Fatalf("tests[%d]-token wrong.expected=%q, got=%q", i, tt.expectType, tok.Type)
+		}
+		if tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d]-literal wrong.expected=%q, got=%q", i, tt.expectLiteral, tok.Literal)
+		}
+	}
+}
+
+func Test_Compound_Assign_Lexer(t *testing.T) {
+	input := "x += 1; x -= 2; x *= 3; x /= 4; x = 5"
+
+	expected := []token.TokenType{
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASSIGN, token.INT, token.EOF,
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d]-token wrong.expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func Test_Logical_Lexer(t *testing.T) {
+	input := "a && b || c & d"
+
+	expected := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType || tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d] wrong.expected=%q %q, got=%q %q", i, tt.expectType, tt.expectLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func Test_Comparison_Lexer(t *testing.T) {
+	input := "a <= b >= c % d < e"
+
+	expected := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.LT, "<"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType || tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d] wrong.expected=%q %q, got=%q %q", i, tt.expectType, tt.expectLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func Test_Number_Lexer(t *testing.T) {
+	input := "3.14 1e-9 2E+3 7 1.x 1e"
+
+	expected := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.INT, "7"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType || tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d] wrong.expected=%q %q, got=%q %q", i, tt.expectType, tt.expectLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func Test_String_Escape_Lexer(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{`"a\nb\tc\rd"`, token.STRING, "a\nb\tc\rd"},
+		{`"\"quoted\" \\ end"`, token.STRING, `"quoted" \ end`},
+		{`"nul\0"`, token.STRING, "nul\x00"},
+		{`"\u00e9\u{1F600}\u{41}"`, token.STRING, "é😀A"},
+		{`"é"`, token.STRING, "é"},
+		{`"open`, token.ERROR, "unterminated string"},
+		{`"trailing\`, token.ERROR, "unterminated string"},
+		{`"\q"`, token.ERROR, `unknown escape sequence: \q`},
+		{`"\u12"`, token.ERROR, `invalid unicode escape: expected \uXXXX with 4 hex digits`},
+		{`"\u{}"`, token.ERROR, `invalid unicode escape: expected \u{X} with 1 to 6 hex digits`},
+		{`"\u{110000}"`, token.ERROR, "invalid unicode code point: U+110000"},
+		{`"\uD800"`, token.ERROR, "invalid unicode code point: U+D800"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tok := lexer.New(tt.input).NextToken()
+			if tok.Type != tt.expectType || tok.Literal != tt.expectLiteral {
+				t.Fatalf("expected %q %q, got %q %q", tt.expectType, tt.expectLiteral, tok.Type, tok.Literal)
+			}
+		})
+	}
+}
+
+func Test_String_Error_Recovery_Lexer(t *testing.T) {
+	l := lexer.New(`"bad\q" 1`)
+
+	tok := l.NextToken()
+	if tok.Type != token.ERROR || tok.Pos.Column != 5 {
+		t.Fatalf("expected ERROR at column 5, got %q %q at %s", tok.Type, tok.Literal, tok.Pos)
+	}
+	tok = l.NextToken()
+	if tok.Type != token.INT || tok.Literal != "1" {
+		t.Fatalf("expected INT 1 after bad string, got %q %q", tok.Type, tok.Literal)
+	}
+}
+
+func Test_Comment_Lexer(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing
+/* block
+   comment */ x /* inline */ * 3
+//`
+
+	expected := []struct {
+		expectType    token.TokenType
+		expectLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK, "*"},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	l.KeepComments()
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectType || tok.Literal != tt.expectLiteral {
+			t.Fatalf("tests[%d] wrong.expected=%q %q, got=%q %q", i, tt.expectType, tt.expectLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	comments := []struct {
+		text  string
+		pos   string
+		block bool
+	}{
+		{"// leading", "1:1", false},
+		{"// trailing", "2:17", false},
+		{"/* block\n   comment */", "3:1", true},
+		{"/* inline */", "4:17", true},
+		{"//", "5:1", false},
+	}
+	if len(l.Comments()) != len(comments) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d (%v)", len(comments), len(l.Comments()), l.Comments())
+	}
+	for i, c := range comments {
+		got := l.Comments()[i]
+		if got.Text != c.text || got.Pos.String() != c.pos || got.Block != c.block {
+			t.Fatalf("comments[%d] wrong. want=%q at %s, got=%q at %s", i, c.text, c.pos, got.Text, got.Pos)
+		}
+	}
+}
+
+func Test_Comment_Discarded_Lexer(t *testing.T) {
+	l := lexer.New("1 // note\n2")
+	for l.NextToken().Type != token.EOF {
+	}
+	if len(l.Comments()) != 0 {
+		t.Fatalf("comments should not be kept by default, got %v", l.Comments())
+	}
+}
+
+func Test_Unterminated_Comment_Lexer(t *testing.T) {
+	l := lexer.New("1 /* never closed")
+
+	tok := l.NextToken()
+	if tok.Type != token.INT {
+		t.Fatalf("expected INT, got %q %q", tok.Type, tok.Literal)
+	}
+	tok = l.NextToken()
+	if tok.Type != token.ERROR || tok.Literal != "unterminated block comment" || tok.Pos.Column != 3 {
+		t.Fatalf("expected unterminated block comment at column 3, got %q %q at %s", tok.Type, tok.Literal, tok.Pos)
+	}
+	if tok = l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF after error, got %q %q", tok.Type, tok.Literal)
+	}
+}
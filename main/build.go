@@ -0,0 +1,67 @@
+package main
+
+import (
+	"Monkey/bytecode"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const buildUsage = "usage: monkey build [-o file.mkc] file.mk"
+
+// buildCommand 实现 monkey build 子命令：把脚本编译为字节码文件，之后可以用 monkey run 直接执行
+func buildCommand(arguments []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "output file, defaults to the source file with the .mkc extension")
+	if err := fs.Parse(arguments); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, buildUsage)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	file, ok := compileFile(path, string(src), stderr)
+	if !ok {
+		return 1
+	}
+
+	data, err := bytecode.Encode(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return 1
+	}
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// compileFile 解析并编译源码，出错时输出诊断信息并返回false
+func compileFile(path string, src string, stderr io.Writer) (*bytecode.File, bool) {
+	program, ok := parseScript(path, src, "text", stderr)
+	if !ok {
+		return nil, false
+	}
+	bc, symbolTable, err := compileScript(program)
+	if err != nil {
+		reportError(stderr, "text", src, err)
+		return nil, false
+	}
+	return &bytecode.File{Bytecode: bc, Globals: symbolTable.GlobalNames(), Source: src}, true
+}
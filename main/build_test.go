@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildAndRunBytecode(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "script.mk")
+	source := "let check = fn(n) { if (n > 1) { 1 / 0 } else { n } };\ncheck(len(args));"
+	if err := os.WriteFile(src, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if code := buildCommand([]string{src}, &stderr); code != 0 {
+		t.Fatalf("build failed with code %d: %s", code, stderr.String())
+	}
+	compiled := filepath.Join(dir, "script.mkc")
+	if _, err := os.Stat(compiled); err != nil {
+		t.Fatalf("default output not written: %s", err)
+	}
+
+	// 编译之后删除源码，字节码文件可以单独运行，错误信息中的代码片段来自文件中保存的源码
+	os.Remove(src)
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"ok", []string{compiled, "a"}, 0, ""},
+		{"runtime error", []string{compiled, "a", "b"}, 1, "script.mk:1:36: error: division by zero\n 1 | let check"},
+		{"stack trace", []string{compiled, "a", "b"}, 1, "script.mk:1:36)\n    at <main> ("},
+		{"eval engine", []string{"-engine=eval", compiled}, 2, "compiled bytecode can only run on the vm engine"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			code := runCommand(tt.args, &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("wrong exit code. want=%d, got=%d (stderr=%q)", tt.expectedCode, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("stderr does not contain %q. got=%q", tt.expectedErr, stderr.String())
+			}
+		})
+	}
+
+	var stdout bytes.Buffer
+	stderr.Reset()
+	if code := disasmCommand([]string{compiled}, &stdout, &stderr); code != 0 {
+		t.Fatalf("disasm failed with code %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{"  0004  OpSetGlobal 1            ; check\n", "; 2 | check(len(args));\n", "== fn check (constant "} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("disasm output does not contain %q. got=%q", want, stdout.String())
+		}
+	}
+}
+
+func TestBuildCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name         string
+		source       string
+		flags        []string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"parser error", "let = 1;", nil, 1, "script.mk:1:5: error: peekToken want to be [IDENT]"},
+		{"compile error", "x;", nil, 1, "script.mk:1:1: error: undefined variable: x"},
+		{"output flag", "1", []string{"-o", filepath.Join(dir, "out.bin")}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "script.mk")
+			if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stderr bytes.Buffer
+			code := buildCommand(append(tt.flags, path), &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("wrong exit code. want=%d, got=%d (stderr=%q)", tt.expectedCode, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("stderr does not contain %q. got=%q", tt.expectedErr, stderr.String())
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "out.bin")); err != nil {
+		t.Errorf("-o output not written: %s", err)
+	}
+
+	corrupted := filepath.Join(dir, "bad.mkc")
+	os.WriteFile(corrupted, []byte("MKBC\x00\x01garbage!"), 0o644)
+	var stderr bytes.Buffer
+	if code := runCommand([]string{corrupted}, &stderr); code != 1 || !strings.Contains(stderr.String(), "checksum mismatch") {
+		t.Errorf("corrupted file not rejected. code=%d, stderr=%q", code, stderr.String())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"Monkey/bytecode"
+	"Monkey/disasm"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const disasmUsage = "usage: monkey disasm file.mk|file.mkc"
+
+// disasmCommand 实现 monkey disasm 子命令：编译脚本但不执行，输出反汇编结果
+// 也可以反汇编 monkey build 生成的字节码文件
+func disasmCommand(arguments []string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(arguments); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, disasmUsage)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var file *bytecode.File
+	if bytecode.IsBytecode(data) {
+		if file, err = bytecode.Decode(data); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return 1
+		}
+	} else {
+		var ok bool
+		if file, ok = compileFile(path, string(data), stderr); !ok {
+			return 1
+		}
+	}
+
+	disasm.Disassemble(stdout, file.Bytecode, disasm.Options{Source: file.Source, Globals: file.Globals})
+	return 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDisasmCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         string
+		args           []string
+		expectedCode   int
+		expectedOutput []string
+		expectedErr    string
+	}{
+		{
+			"ok",
+			"let square = fn(x) { x * x };\nsquare(len(args));",
+			nil,
+			0,
+			[]string{
+				"== main ==\n; 1 | let square = fn(x) { x * x };\n  0000  OpClosure 0 0            ; fn square\n",
+				"  0004  OpSetGlobal 1            ; square\n",
+				"  0010  OpGetBuiltin 0           ; len\n  0012  OpGetGlobal 0            ; args\n",
+				"== fn square (constant 0, params 1, locals 1) ==\n",
+			},
+			"",
+		},
+		{"parser error", "let = 1;", nil, 1, nil, "script.mk:1:5: error: peekToken want to be [IDENT]"},
+		{"compile error", "x;", nil, 1, nil, "script.mk:1:1: error: undefined variable: x"},
+		{"extra arguments", "1", []string{"extra"}, 2, nil, "usage: monkey disasm"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "script.mk")
+			if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := disasmCommand(append([]string{path}, tt.args...), &stdout, &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("wrong exit code. want=%d, got=%d (stderr=%q)", tt.expectedCode, code, stderr.String())
+			}
+			for _, want := range tt.expectedOutput {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout does not contain %q. got=%q", want, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("stderr does not contain %q. got=%q", tt.expectedErr, stderr.String())
+			}
+		})
+	}
+}
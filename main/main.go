@@ -2,17 +2,36 @@ package main
 
 import (
 	"Monkey/repl"
+	"flag"
 	"fmt"
 	"os"
 	user2 "os/user"
 )
 
+var engine = flag.String("engine", repl.EngineVM, "execution engine: eval or vm")
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:], os.Stderr))
+		case "build":
+			os.Exit(buildCommand(os.Args[2:], os.Stderr))
+		case "disasm":
+			os.Exit(disasmCommand(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	flag.Parse()
+
 	user, err := user2.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	if err := repl.Start(os.Stdin, os.Stdout, *engine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"Monkey/ast"
+	"Monkey/bytecode"
+	"Monkey/compiler"
+	"Monkey/diagnostic"
+	"Monkey/evaluator"
+	"Monkey/lexer"
+	"Monkey/object"
+	"Monkey/parser"
+	"Monkey/repl"
+	"Monkey/vm"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ArgsName 脚本参数以字符串数组的形式绑定到这个全局变量
+const ArgsName = "args"
+
+const runUsage = "usage: monkey run [-engine=eval|vm] [-diagnostics=text|json] file.mk|file.mkc [args...]"
+
+// runCommand 实现 monkey run 子命令，返回进程退出码
+func runCommand(arguments []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	engine := fs.String("engine", repl.EngineVM, "execution engine: eval or vm")
+	format := fs.String("diagnostics", "text", "diagnostics output format: text or json")
+	if err := fs.Parse(arguments); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(stderr, runUsage)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// 字节码文件跳过解析和编译，直接在虚拟机中执行
+	if bytecode.IsBytecode(data) {
+		if *engine != repl.EngineVM {
+			fmt.Fprintf(stderr, "%s: compiled bytecode can only run on the %s engine\n", path, repl.EngineVM)
+			return 2
+		}
+		file, err := bytecode.Decode(data)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return 1
+		}
+		if _, err := runBytecode(file.Bytecode, file.Globals, fs.Args()[1:]); err != nil {
+			reportError(stderr, *format, file.Source, err)
+			return 1
+		}
+		return 0
+	}
+
+	src := string(data)
+	program, ok := parseScript(path, src, *format, stderr)
+	if !ok {
+		return 1
+	}
+
+	_, err = execute(program, *engine, fs.Args()[1:])
+	if err != nil {
+		reportError(stderr, *format, src, err)
+		return 1
+	}
+	return 0
+}
+
+// parseScript 解析脚本，出错时输出诊断信息并返回false
+func parseScript(path string, src string, format string, stderr io.Writer) (*ast.Program, bool) {
+	l := lexer.NewWithFile(src, path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		reportDiagnostics(stderr, format, src, p.Diagnostics())
+		return nil, false
+	}
+	return program, true
+}
+
+// reportError 输出编译或运行时错误，不是*diagnostic.Diagnostic的错误没有源码位置
+func reportError(w io.Writer, format string, src string, err error) {
+	d, ok := err.(*diagnostic.Diagnostic)
+	if !ok {
+		d = diagnostic.Errorf(diagnostic.Span{}, "%s", err)
+	}
+	reportDiagnostics(w, format, src, []*diagnostic.Diagnostic{d})
+}
+
+func reportDiagnostics(w io.Writer, format string, src string, diags []*diagnostic.Diagnostic) {
+	if format == "json" {
+		diagnostic.RenderJSON(w, diags)
+		return
+	}
+	diagnostic.Render(w, src, diags)
+}
+
+// execute 使用指定的引擎执行整个程序，返回最后一个表达式的值
+// 编译错误和运行时错误以*diagnostic.Diagnostic返回
+func execute(program *ast.Program, engine string, scriptArgs []string) (object.Object, error) {
+	switch engine {
+	case repl.EngineEval:
+		env := object.NewEnvironment()
+		env.Set(ArgsName, newArgsArray(scriptArgs))
+
+		result := evaluator.Eval(program, env)
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, errObj.Diagnostic()
+		}
+		return result, nil
+	case repl.EngineVM:
+		bc, symbolTable, err := compileScript(program)
+		if err != nil {
+			return nil, err
+		}
+		return runBytecode(bc, symbolTable.GlobalNames(), scriptArgs)
+	default:
+		return nil, fmt.Errorf("unknown engine %q, want %q or %q", engine, repl.EngineEval, repl.EngineVM)
+	}
+}
+
+// compileScript 编译脚本，全局符号表中预先定义了所有内置函数和args
+func compileScript(program *ast.Program) (*compiler.Bytecode, *compiler.SymbolTable, error) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	symbolTable.Define(ArgsName)
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, nil, err
+	}
+	return comp.Bytecode(), symbolTable, nil
+}
+
+// runBytecode 在虚拟机中执行字节码，globalNames中名为args的全局变量绑定为脚本参数
+func runBytecode(bc *compiler.Bytecode, globalNames map[int]string, scriptArgs []string) (object.Object, error) {
+	globals := make([]object.Object, vm.GlobalsSize)
+	for index, name := range globalNames {
+		if name == ArgsName && index < len(globals) {
+			globals[index] = newArgsArray(scriptArgs)
+		}
+	}
+
+	machine := vm.NewWithGlobalsStore(bc, globals)
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+func newArgsArray(scriptArgs []string) *object.Array {
+	elements := make([]object.Object, len(scriptArgs))
+	for i, a := range scriptArgs {
+		elements[i] = &object.String{Value: a}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"Monkey/lexer"
+	"Monkey/object"
+	"Monkey/parser"
+	"Monkey/repl"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecuteExposesArgs(t *testing.T) {
+	input := `let greet = fn(name) { "hello " + name }; greet(args[1]);`
+
+	for _, engine := range []string{repl.EngineEval, repl.EngineVM} {
+		t.Run(engine, func(t *testing.T) {
+			p := parser.New(lexer.New(input))
+			program := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			result, err := execute(program, engine, []string{"a", "monkey"})
+			if err != nil {
+				t.Fatalf("execute returned error: %s", err)
+			}
+			str, ok := result.(*object.String)
+			if !ok {
+				t.Fatalf("result is not String. got=%T (%+v)", result, result)
+			}
+			if str.Value != "hello monkey" {
+				t.Errorf("wrong result. want=%q, got=%q", "hello monkey", str.Value)
+			}
+		})
+	}
+}
+
+func TestRunCommandExitCodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		flags        []string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"ok", "#!/usr/bin/env monkey run\nlet x = 1; x + 1;", nil, 0, ""},
+		{"top-level return", "let x = 1;\nreturn x;\nx + true;", nil, 0, ""},
+		{"top-level return eval", "let x = 1;\nreturn x;\nx + true;", []string{"-engine=eval"}, 0, ""},
+		{"parser error", "let x = 1;\nlet = 1;", nil, 1, "script.mk:2:5: error: peekToken want to be [IDENT]"},
+		{"compile error", "let x = 1;\nx + y;", nil, 1, "script.mk:2:5: error: undefined variable: y\n 2 | x + y;\n   |     ^\n   = hint: "},
+		{"vm runtime error", "let x = 1;\nx + true;", nil, 1, "script.mk:2:3: error: unsupport types for binary operation"},
+		{"eval runtime error", "let x = 1;\nx + true;", []string{"-engine=eval"}, 1, "script.mk:2:3: error: type mismatch: INTEGER + BOOLEAN"},
+		{"json", "x;", []string{"-diagnostics=json"}, 1, `"message": "undefined variable: x"`},
+		{"bad format", "1", []string{"-diagnostics=xml"}, 2, "usage"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "script.mk")
+			if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stderr bytes.Buffer
+			code := runCommand(append(tt.flags, path), &stderr)
+			if code != tt.expectedCode {
+				t.Errorf("wrong exit code. want=%d, got=%d (stderr=%q)", tt.expectedCode, code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.expectedErr) {
+				t.Errorf("stderr does not contain %q. got=%q", tt.expectedErr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// BigInt 超出int64范围的整数
+// 运算结果总是经过NewInteger规范化：能用int64表示的值一定是*Integer，
+// 因此同一个整数值只有一种表示，比较和作为哈希键时不会出现两种对象表示同一个值的情况
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType {
+	return BIG_INTEGER_OBJ
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// NewInteger 把任意精度的整数转换为对象，能用int64表示时返回*Integer，否则返回*BigInt
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+// AsBigInt 把*Integer或*BigInt转换为*big.Int，其他类型返回false
+// 返回的值可能与对象共享内存，调用方不能修改它
+func AsBigInt(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInt:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// AddInt 整数加法，溢出时提升为*BigInt
+func AddInt(a, b int64) Object {
+	result := a + b
+	if (a > 0 && b > 0 && result < 0) || (a < 0 && b < 0 && result >= 0) {
+		return NewInteger(new(big.Int).Add(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: result}
+}
+
+// SubInt 整数减法，溢出时提升为*BigInt
+func SubInt(a, b int64) Object {
+	result := a - b
+	if (a >= 0 && b < 0 && result < 0) || (a < 0 && b > 0 && result >= 0) {
+		return NewInteger(new(big.Int).Sub(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: result}
+}
+
+// MulInt 整数乘法，溢出时提升为*BigInt
+func MulInt(a, b int64) Object {
+	if a == 0 || b == 0 {
+		return &Integer{Value: 0}
+	}
+	result := a * b
+	if result/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return NewInteger(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: result}
+}
+
+// DivInt 整数除法，向零取整，math.MinInt64 / -1溢出时提升为*BigInt
+// 除数为0时的错误由调用方处理
+func DivInt(a, b int64) Object {
+	if a == math.MinInt64 && b == -1 {
+		return NewInteger(new(big.Int).Neg(big.NewInt(a)))
+	}
+	return &Integer{Value: a / b}
+}
+
+// NegInt 整数取负，-math.MinInt64溢出时提升为*BigInt
+func NegInt(a int64) Object {
+	if a == math.MinInt64 {
+		return NewInteger(new(big.Int).Neg(big.NewInt(a)))
+	}
+	return &Integer{Value: -a}
+}
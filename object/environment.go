@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
 	return &Environment{store: s, outer: nil}
@@ -23,6 +25,28 @@ func (e *Environment) Set(name string, obj Object) Object {
 	return obj
 }
 
+// Assign 修改名称所在的（最内层定义了该名称的）作用域中的绑定，名称未定义时返回false
+func (e *Environment) Assign(name string, obj Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = obj
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+	return false
+}
+
+// Names 返回当前作用域（不含外层）中定义的名称，按字典序排列
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
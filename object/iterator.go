@@ -0,0 +1,165 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Iterator for-in循环使用的迭代器，求值器和虚拟机共用
+// 迭代器也是Object，虚拟机在循环期间把它放在栈上
+type Iterator interface {
+	Object
+	// Next 返回下一个元素的键和值，没有更多元素时ok为false
+	// 数组、字符串和区间的键为从0开始的下标
+	Next() (key Object, value Object, ok bool)
+}
+
+// Iterable 可以被for-in循环遍历的对象
+type Iterable interface {
+	Object
+	Iterator() Iterator
+}
+
+type arrayIterator struct {
+	elements []Object
+	index    int
+}
+
+func (a *Array) Iterator() Iterator {
+	return &arrayIterator{elements: a.Elements}
+}
+
+func (it *arrayIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *arrayIterator) Inspect() string  { return "<array iterator>" }
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.elements) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: int64(it.index)}
+	value := it.elements[it.index]
+	it.index++
+	return key, value, true
+}
+
+// hashIterator 遍历创建迭代器时的键值对快照，顺序见SortedPairs
+type hashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+func (h *Hash) Iterator() Iterator {
+	return &hashIterator{pairs: h.SortedPairs()}
+}
+
+func (it *hashIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *hashIterator) Inspect() string  { return "<hash iterator>" }
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.index]
+	it.index++
+	return pair.Key, pair.Value, true
+}
+
+// stringIterator 按字符（rune）遍历字符串，值为单个字符组成的字符串
+type stringIterator struct {
+	value  string
+	offset int // 下一个字符的字节偏移
+	index  int // 下一个字符的下标
+}
+
+func (s *String) Iterator() Iterator {
+	return &stringIterator{value: s.Value}
+}
+
+func (it *stringIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *stringIterator) Inspect() string  { return "<string iterator>" }
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.offset >= len(it.value) {
+		return nil, nil, false
+	}
+	_, size := utf8.DecodeRuneInString(it.value[it.offset:])
+	key := &Integer{Value: int64(it.index)}
+	value := &String{Value: it.value[it.offset : it.offset+size]}
+	it.offset += size
+	it.index++
+	return key, value, true
+}
+
+// Range 由内置函数range创建的整数区间[Start, End)，按需产生元素
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64 // 不为0，可以为负数
+}
+
+func (r *Range) Type() ObjectType {
+	return RANGE_OBJ
+}
+
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.End)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+type rangeIterator struct {
+	r     *Range
+	next  int64
+	index int64
+}
+
+func (r *Range) Iterator() Iterator {
+	return &rangeIterator{r: r, next: r.Start}
+}
+
+func (it *rangeIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *rangeIterator) Inspect() string  { return "<range iterator>" }
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.r.Step > 0 && it.next >= it.r.End || it.r.Step < 0 && it.next <= it.r.End {
+		return nil, nil, false
+	}
+	key := &Integer{Value: it.index}
+	value := &Integer{Value: it.next}
+	it.next += it.r.Step
+	it.index++
+	return key, value, true
+}
+
+// SortedPairs 按键排序的键值对，保证遍历和输出的顺序确定
+// 先按键的类型排序，同类型的键再按值排序
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *BigInt:
+		return a.Value.Cmp(b.(*BigInt).Value) < 0
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
@@ -2,25 +2,42 @@ package object
 
 import (
 	"Monkey/ast"
+	"Monkey/code"
+	"Monkey/diagnostic"
+	"Monkey/token"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+	RANGE_OBJ             = "RANGE"
+	ITERATOR_OBJ          = "ITERATOR"
+	CELL_OBJ              = "CELL"
 )
 
 type BuiltinFunction func(args ...Object) Object
@@ -46,6 +63,38 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+type Float struct {
+	Value float64
+}
+
+// Inspect 使用能精确还原数值的最短表示，整数值的浮点数保留".0"以区别于整数
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// AsFloat 把整数或浮点数转换为float64，用于整数和浮点数混合运算时的类型提升
+func AsFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -81,8 +130,32 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break 求值器中break的信号，沿块语句向外传递到最内层循环
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// Continue 求值器中continue的信号，沿块语句向外传递到最内层循环
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 type Error struct {
 	Message string
+	Pos     token.Position          // 出错节点的位置，由求值器填写
+	Trace   []diagnostic.StackFrame // 调用栈，最内层在前，由求值器在错误向外传递时填写
 }
 
 func (e *Error) Type() ObjectType {
@@ -93,10 +166,18 @@ func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
+// Diagnostic 转换为诊断信息，与虚拟机的运行时错误格式一致
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(diagnostic.PosSpan(e.Pos), "%s", e.Message)
+	d.Trace = e.Trace
+	return d
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // 通过let绑定时的名称，用于调用栈
 }
 
 func (f *Function) Type() ObjectType {
@@ -132,6 +213,25 @@ func (s *String) Inspect() string {
 	return s.Value
 }
 
+// Len 字符（rune）个数，而不是字节数
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// CharAt 返回第index个字符（rune）组成的字符串，越界时返回false
+func (s *String) CharAt(index int64) (*String, bool) {
+	if index < 0 {
+		return nil, false
+	}
+	for i, r := range s.Value {
+		if index == 0 {
+			return &String{Value: s.Value[i : i+utf8.RuneLen(r)]}, true
+		}
+		index--
+	}
+	return nil, false
+}
+
 type Builtin struct {
 	Fn BuiltinFunction
 }
@@ -183,7 +283,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.SortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{")
@@ -192,6 +292,37 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction 编译后的函数，保存函数体的字节码指令
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // 局部绑定的个数，用于在栈上预留空间
+	NumParameters int
+	SourceMap     code.SourceMap // 指令对应的源码位置，用于运行时报错
+	Name          string         // 通过let绑定时的名称，用于调用栈
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure 闭包，Free保存函数创建时捕获的自由变量
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return CLOSURE_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -218,3 +349,17 @@ func (s *String) HashKey() HashKey {
 
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
+
+// Cell 虚拟机中被闭包捕获的局部绑定
+// 外层函数的局部变量槽位和闭包的Free中保存同一个Cell，任何一方赋值另一方都能看到
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
+func (c *Cell) Inspect() string {
+	return c.Value.Inspect()
+}
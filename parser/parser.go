@@ -2,9 +2,11 @@ package parser
 
 import (
 	"Monkey/ast"
+	"Monkey/diagnostic"
 	"Monkey/lexer"
 	"Monkey/token"
-	"fmt"
+	"errors"
+	"math/big"
 	"strconv"
 )
 
@@ -12,10 +14,12 @@ type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []*diagnostic.Diagnostic
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	loopDepth int // 当前所在的循环层数，函数体内重新从0开始
 }
 
 type (
@@ -27,6 +31,9 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	OR          // ||
+	AND         // &&
 	EQUALS      //==
 	LESSGREATER //> or <
 	SUM         // +
@@ -38,27 +45,45 @@ const (
 
 // 优先级表
 var precedences = map[token.TokenType]int{
-	token.EQ:        EQUALS,
-	token.NOT_EQ:    EQUALS,
-	token.LT:        LESSGREATER,
-	token.GT:        LESSGREATER,
-	token.PLUS:      SUM,
-	token.MINUS:     SUM,
-	token.SLASH:     PRODUCT,
-	token.ASTERISK:  PRODUCT,
-	token.LPAREN:    CALL,
-	token.LBARACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBARACKET:       INDEX,
+}
+
+// closingHints 缺少闭合符号时给出的提示
+var closingHints = map[token.TokenType]string{
+	token.RPAREN:    "check for a missing ')'",
+	token.RBRACE:    "check for a missing '}'",
+	token.RBARACKET: "check for a missing ']'",
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*diagnostic.Diagnostic{},
 	}
 	// 注册前缀函数
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
@@ -72,6 +97,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ERROR, p.parseErrorToken)
 	p.registerPrefix(token.LBARACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	//注册中缀函数
@@ -84,8 +110,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBARACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	//读取两个词法单元以设置curToken和peekToken
 	p.nextToken()
 	p.nextToken()
@@ -93,7 +129,17 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Errors 返回"位置: 信息"格式的错误文本
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, d := range p.errors {
+		msgs[i] = d.Error()
+	}
+	return msgs
+}
+
+// Diagnostics 返回结构化的错误信息
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
 	return p.errors
 }
 
@@ -122,6 +168,12 @@ func (p *Parser) ParseStatement() ast.Statement {
 		return p.ParseLetStatement()
 	case token.RETURN:
 		return p.ParseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.ParseExpressionStatement()
 	}
@@ -142,7 +194,12 @@ func (p *Parser) ParseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	// 记录函数名，编译器据此支持递归闭包
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -153,12 +210,96 @@ func (p *Parser) ParseReturnStatement() *ast.ReturnStatement {
 
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.loopDepth++
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.loopDepth++
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
+// parseLoopControlStatement 解析break和continue，它们只能出现在循环体中
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if p.loopDepth == 0 {
+		d := diagnostic.Errorf(diagnostic.TokenSpan(tok), "%s outside of loop", tok.Literal)
+		p.errors = append(p.errors, d)
+		return nil
+	}
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) ParseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -195,14 +336,29 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	num, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			return &ast.IntegerLiteral{Token: p.curToken, Big: value}
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %v as interger", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		d := diagnostic.Errorf(diagnostic.TokenSpan(p.curToken), "could not parse %v as interger", p.curToken.Literal)
+		p.errors = append(p.errors, d)
 		return nil
 	}
 	return &ast.IntegerLiteral{Token: p.curToken, Value: num}
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	num, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		d := diagnostic.Errorf(diagnostic.TokenSpan(p.curToken), "could not parse %v as float", p.curToken.Literal)
+		p.errors = append(p.errors, d)
+		return nil
+	}
+	return &ast.FloatLiteral{Token: p.curToken, Value: num}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -222,8 +378,11 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("peekToken want to be [%v], but got [%v] ", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := diagnostic.Errorf(diagnostic.TokenSpan(p.peekToken), "peekToken want to be [%v], but got [%v] ", t, p.peekToken.Type)
+	if hint, ok := closingHints[t]; ok {
+		d.WithHint(hint)
+	}
+	p.errors = append(p.errors, d)
 }
 
 func (p *Parser) registerPrefix(tokeType token.TokenType, fn prefixParseFn) {
@@ -235,8 +394,11 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	d := diagnostic.Errorf(diagnostic.TokenSpan(p.curToken), "no prefix parse function for %s found", t)
+	if t == token.EOF {
+		d.WithHint("the input ended in the middle of an expression")
+	}
+	p.errors = append(p.errors, d)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -274,6 +436,30 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression 赋值是右结合的，a = b = 1 等价于 a = (b = 1)
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		// 左侧解析失败，已经记录过错误
+		return nil
+	default:
+		d := diagnostic.Errorf(diagnostic.TokenSpan(p.curToken), "invalid assignment target: %s", target)
+		p.errors = append(p.errors, d)
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
@@ -344,13 +530,18 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	// break和continue不能跨越函数边界
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fn.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	return fn
 }
 
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	var idents []*ast.Identifier
 	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
 		return idents
 	}
 	p.nextToken()
@@ -375,6 +566,13 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
+
+// parseErrorToken 报告词法分析阶段发现的错误，Literal即错误信息
+func (p *Parser) parseErrorToken() ast.Expression {
+	d := diagnostic.Errorf(diagnostic.PosSpan(p.curToken.Pos), "%s", p.curToken.Literal)
+	p.errors = append(p.errors, d)
+	return nil
+}
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBARACKET)
@@ -137,6 +137,44 @@ func TestIntgerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	p := parser.New(lexer.New("99999999999999999999;"))
+	program := p.ParseProgram()
+	parser.CheckErrors(t, p)
+	require.Len(t, program.Statements, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	require.True(t, ok)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	require.True(t, ok, "exp not *ast.IntegerLiteral, got [%T]", stmt.Expression)
+	require.NotNil(t, literal.Big)
+	require.Equal(t, "99999999999999999999", literal.Big.String())
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E+3;", 2500},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		parser.CheckErrors(t, p)
+		require.Len(t, program.Statements, 1)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		require.True(t, ok)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		require.True(t, ok, "exp not *ast.FloatLiteral, got [%T]", stmt.Expression)
+		require.Equal(t, tt.expected, literal.Value)
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -336,6 +374,12 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a+add(b*c)+d", "((a + add((b * c))) + d)"},
 		{"add(a,b,1,2*3,4+5,add(6,7*8))", "add(a,b,1,(2 * 3),(4 + 5),add(6,(7 * 8)))"},
 		{"(3-2)", "(3 - 2)"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a < b && c == d", "((a < b) && (c == d))"},
+		{"x = a || b", "(x = (a || b))"},
 		//{"a*[1,2,3,4][b*c]*d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		//{"add(a*b[2], b[1], 2 * [1,2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
 	}
@@ -369,12 +413,111 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue; }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	parser.CheckErrors(t, p)
+
+	require.Len(t, program.Statements, 1)
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	require.True(t, ok, "statement is not *ast.WhileStatement. got=%T", program.Statements[0])
+	require.Equal(t, "(x < 10)", stmt.Condition.String())
+	require.Len(t, stmt.Body.Statements, 2)
+	_, ok = stmt.Body.Statements[1].(*ast.ContinueStatement)
+	require.True(t, ok, "statement is not *ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"for (x in arr) { x }", "for ( x in arr ) { x }"},
+		{"for (k, v in hash) { break; };", "for ( k, v in hash ) { break; }"},
+		{"for (c in \"ab\" + s) { continue; }", "for ( c in (ab + s) ) { continue; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			parser.CheckErrors(t, p)
+
+			require.Len(t, program.Statements, 1)
+			_, ok := program.Statements[0].(*ast.ForStatement)
+			require.True(t, ok, "statement is not *ast.ForStatement. got=%T", program.Statements[0])
+			require.Equal(t, tt.expect, program.String())
+		})
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x += y * 2", "(x += (y * 2))"},
+		{"a = b = c", "(a = (b = c))"},
+		{"arr[i + 1] -= 1", "((arr[(i + 1)]) -= 1)"},
+		{"h[\"k\"] /= 2;", "((h[k]) /= 2)"},
+		{"x *= f(1) == 2", "(x *= (f(1) == 2))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			parser.CheckErrors(t, p)
+
+			require.Equal(t, tt.expected, program.String())
+		})
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	l := lexer.New("f() = 1")
+	p := parser.New(l)
+	p.ParseProgram()
+
+	require.NotEmpty(t, p.Errors())
+	require.Equal(t, "1:5: invalid assignment target: f()", p.Errors()[0])
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of loop"},
+		{"if (true) { continue; }", "1:13: continue outside of loop"},
+		{"while (true) { let f = fn() { break; }; }", "1:31: break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			p.ParseProgram()
+
+			require.NotEmpty(t, p.Errors())
+			require.Equal(t, tt.expected, p.Errors()[0])
+		})
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	tests := []struct {
 		input  string
 		expect string
 	}{
 		{`fn(x,y){x+y;}`, `fn(x,y){ (x + y) }`},
+		{`fn(){1}`, `fn(){ 1 }`},
 	}
 
 	for _, tt := range tests {
@@ -429,6 +572,7 @@ func TestLetStatements(t *testing.T) {
 		{"let x=5;", "x", 5},
 		{"let y =true;", "y", true},
 		{"let foobar =y;", "foobar", "y"},
+		{"let z = 1", "z", 1},
 	}
 
 	for _, tt := range tests {
@@ -604,3 +748,70 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestCommentsAreSkipped(t *testing.T) {
+	input := `// header
+let x = 1; /* between */ let y = x // trailing
+/* before the call */ y(x);`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	parser.CheckErrors(t, p)
+
+	require.Len(t, program.Statements, 3)
+	require.Equal(t, "let x=1;let y=x;y(x)", program.String())
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet = 2;", "main.mk:2:5: peekToken want to be [IDENT], but got [=] "},
+		{"let x = 1;\n  ;", "main.mk:2:3: no prefix parse function for ; found"},
+		{"let s = \"abc", "main.mk:1:9: unterminated string"},
+		{"let s = \"a\\qb\";", "main.mk:1:11: unknown escape sequence: \\q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.NewWithFile(tt.input, "main.mk")
+			p := parser.New(l)
+			p.ParseProgram()
+
+			require.NotEmpty(t, p.Errors())
+			require.Equal(t, tt.expected, p.Errors()[0])
+		})
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1, 2)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	parser.CheckErrors(t, p)
+
+	require.Equal(t, 2, len(program.Statements))
+
+	let := program.Statements[0].(*ast.LetStatement)
+	require.Equal(t, "1:1", let.Pos().String())
+	require.Equal(t, "1:5", let.Name.Pos().String())
+
+	fn := let.Value.(*ast.FunctionLiteral)
+	require.Equal(t, "1:11", fn.Pos().String())
+
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	infix := body.Expression.(*ast.InfixExpression)
+	require.Equal(t, "2:5", infix.Pos().String())
+	require.Equal(t, "2:3", infix.Left.Pos().String())
+
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	require.Equal(t, "4:4", call.Pos().String())
+	require.Equal(t, "4:5", call.Arguments[0].Pos().String())
+	require.Equal(t, "1:1", program.Pos().String())
+}
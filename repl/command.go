@@ -0,0 +1,163 @@
+package repl
+
+import (
+	"Monkey/ast"
+	"Monkey/lexer"
+	"Monkey/object"
+	"Monkey/parser"
+	"Monkey/token"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// session 一次REPL会话，保存执行引擎以便:reset时重新创建
+type session struct {
+	out        io.Writer
+	engineName string
+	engine     engine
+}
+
+// commands 元命令及其说明，用于:help
+var commands = []struct {
+	name string
+	help string
+}{
+	{":ast <code>", "print the parsed program"},
+	{":tokens <code>", "print the tokens produced by the lexer"},
+	{":bytecode <code>", "print the compiled bytecode without running it (vm engine)"},
+	{":globals", "list global bindings and their values"},
+	{":load <file>", "run a source file in the current session"},
+	{":reset", "discard all bindings and start over"},
+	{":cancel", "discard an unfinished multi-line input"},
+	{":help", "show this help"},
+	{":quit", "exit the REPL"},
+}
+
+// keywords 用于补全的关键字
+var keywords = []string{"break", "continue", "else", "false", "fn", "for", "if", "in", "let", "return", "true", "while"}
+
+// complete 返回以word开头的候选：以':'开头时补全元命令，否则补全关键字、内置函数和当前定义的全局名称
+func (s *session) complete(word string) []string {
+	var names []string
+	if strings.HasPrefix(word, ":") {
+		for _, c := range commands {
+			name, _, _ := strings.Cut(c.name, " ")
+			names = append(names, name)
+		}
+	} else {
+		names = append(names, keywords...)
+		for _, b := range object.Builtins {
+			names = append(names, b.Name)
+		}
+		names = append(names, s.engine.names()...)
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// eval 解析并执行一段源码，file为空表示来自交互输入
+func (s *session) eval(src string, file string) {
+	program, ok := s.parse(src, file)
+	if !ok {
+		return
+	}
+	s.engine.run(s.out, src, program)
+}
+
+// parse 解析源码，出错时输出错误并返回false
+func (s *session) parse(src string, file string) (*ast.Program, bool) {
+	p := parser.New(lexer.NewWithFile(src, file))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		printParserErrors(s.out, src, p.Diagnostics())
+		return nil, false
+	}
+	return program, true
+}
+
+// command 执行以':'开头的元命令，返回false表示退出REPL
+func (s *session) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		for _, c := range commands {
+			fmt.Fprintf(s.out, "%-18s %s\n", c.name, c.help)
+		}
+	case ":reset":
+		s.engine, _ = newEngine(s.engineName)
+		io.WriteString(s.out, "session reset\n")
+	case ":cancel":
+		io.WriteString(s.out, "nothing to cancel\n")
+	case ":globals":
+		s.engine.listGlobals(s.out)
+	case ":tokens":
+		if s.requireArg(name, arg, "<code>") {
+			s.printTokens(arg)
+		}
+	case ":ast":
+		if !s.requireArg(name, arg, "<code>") {
+			break
+		}
+		if program, ok := s.parse(arg, ""); ok {
+			for _, stmt := range program.Statements {
+				fmt.Fprintf(s.out, "%s\n", stmt.String())
+			}
+		}
+	case ":bytecode":
+		if !s.requireArg(name, arg, "<code>") {
+			break
+		}
+		if program, ok := s.parse(arg, ""); ok {
+			s.engine.bytecode(s.out, arg, program)
+		}
+	case ":load":
+		if !s.requireArg(name, arg, "<file>") {
+			break
+		}
+		src, err := os.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintf(s.out, "%s\n", err)
+			break
+		}
+		s.eval(string(src), arg)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type :help for a list of commands\n", name)
+	}
+	return true
+}
+
+func (s *session) requireArg(name string, arg string, want string) bool {
+	if arg == "" {
+		fmt.Fprintf(s.out, "usage: %s %s\n", name, want)
+		return false
+	}
+	return true
+}
+
+// printTokens 每行输出一个词法单元：位置、类型和字面量
+func (s *session) printTokens(src string) {
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			return
+		}
+		fmt.Fprintf(s.out, "%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
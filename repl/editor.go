@@ -0,0 +1,386 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// errInterrupted 用户按下Ctrl-C，放弃当前输入
+var errInterrupted = errors.New("interrupted")
+
+// maxHistory 历史文件中最多保留的行数
+const maxHistory = 1000
+
+// lineReader 按行读取用户输入，输入结束时返回io.EOF
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// newLineReader 输入和输出都是终端时使用支持行编辑的editor，否则（管道、文件、测试）逐行读取
+func newLineReader(in io.Reader, out io.Writer, complete func(word string) []string) lineReader {
+	inFile, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(inFile.Fd())) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	}
+	if outFile, ok := out.(*os.File); !ok || !term.IsTerminal(int(outFile.Fd())) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	}
+
+	ed := newEditor(inFile, out, int(inFile.Fd()))
+	ed.complete = complete
+	if path := historyPath(); path != "" {
+		if err := ed.history.load(path); err != nil {
+			fmt.Fprintf(out, "history disabled: %s\n", err)
+		}
+	}
+	return ed
+}
+
+// historyPath 历史文件的位置，可以用MONKEY_HISTORY环境变量指定，设为空字符串时不保存历史
+func historyPath() string {
+	if path, ok := os.LookupEnv("MONKEY_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// scannerReader 不是终端时的后备实现，不支持行编辑
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *scannerReader) Close() error {
+	return nil
+}
+
+// history 输入历史，设置了文件时每输入一行就追加到文件中，保证异常退出时也不会丢失
+type history struct {
+	lines []string
+	file  *os.File
+}
+
+// load 读取历史文件中最近的maxHistory行，并打开文件用于追加；文件过长时先截断
+func (h *history) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		h.lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		if err := os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600); err != nil {
+			return err
+		}
+	}
+
+	h.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	return err
+}
+
+// add 记录一行输入，忽略空行和与上一行相同的输入
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+	if h.file != nil {
+		fmt.Fprintln(h.file, line)
+	}
+}
+
+func (h *history) close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
+
+// 编辑器识别的控制键
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// editor 简单的行编辑器：光标移动、Ctrl-A/E、上下键浏览历史、Tab补全
+// 只在读取一行期间把终端切换到原始模式，执行代码时的输出不受影响
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int // 终端的文件描述符，小于0时不切换原始模式（用于测试）
+	history  history
+	complete func(word string) []string // 返回以光标前的单词开头的候选，按字典序排列
+
+	prompt  string
+	buf     []rune
+	pos     int    // 光标在buf中的位置
+	histPos int    // 正在浏览的历史下标，等于len(history.lines)表示当前输入
+	draft   []rune // 开始浏览历史前正在编辑的内容
+}
+
+func newEditor(in io.Reader, out io.Writer, fd int) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, fd: fd}
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		state, err := term.MakeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(e.fd, state)
+	}
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	e.histPos, e.draft = len(e.history.lines), nil
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			io.WriteString(e.out, "\r\n")
+			line := string(e.buf)
+			e.history.add(line)
+			return line, nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.moveLeft()
+		case keyCtrlF:
+			e.moveRight()
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlP:
+			e.historyPrev()
+		case keyCtrlN:
+			e.historyNext()
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			e.readEscape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.refresh()
+	}
+}
+
+func (e *editor) Close() error {
+	return e.history.close()
+}
+
+// readEscape 处理方向键等以ESC开头的序列，支持"ESC [ x"和"ESC O x"两种形式
+func (e *editor) readEscape() {
+	prefix, _, err := e.in.ReadRune()
+	if err != nil || (prefix != '[' && prefix != 'O') {
+		return
+	}
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	switch r {
+	case 'A':
+		e.historyPrev()
+	case 'B':
+		e.historyNext()
+	case 'C':
+		e.moveRight()
+	case 'D':
+		e.moveLeft()
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	case '1', '3', '4', '7', '8':
+		// ESC [ n ~：1和7为Home，4和8为End，3为Delete
+		if next, _, err := e.in.ReadRune(); err != nil || next != '~' {
+			return
+		}
+		switch r {
+		case '1', '7':
+			e.pos = 0
+		case '4', '8':
+			e.pos = len(e.buf)
+		case '3':
+			e.deleteAt(e.pos)
+		}
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *editor) deleteAt(pos int) {
+	if pos < len(e.buf) {
+		e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+	}
+}
+
+func (e *editor) moveLeft() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *editor) moveRight() {
+	if e.pos < len(e.buf) {
+		e.pos++
+	}
+}
+
+func (e *editor) historyPrev() {
+	if e.histPos == 0 {
+		return
+	}
+	if e.histPos == len(e.history.lines) {
+		e.draft = e.buf
+	}
+	e.histPos--
+	e.setLine([]rune(e.history.lines[e.histPos]))
+}
+
+func (e *editor) historyNext() {
+	if e.histPos >= len(e.history.lines) {
+		return
+	}
+	e.histPos++
+	if e.histPos == len(e.history.lines) {
+		e.setLine(e.draft)
+		return
+	}
+	e.setLine([]rune(e.history.lines[e.histPos]))
+}
+
+func (e *editor) setLine(line []rune) {
+	e.buf = append([]rune{}, line...)
+	e.pos = len(e.buf)
+}
+
+// completeWord 补全光标前的单词：唯一候选时直接补全，多个候选时补全公共前缀，无法继续补全时列出所有候选
+func (e *editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	word := string(e.buf[wordStart(e.buf[:e.pos]):e.pos])
+	candidates := e.complete(word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		common += " "
+	}
+	if len(common) > len(word) {
+		for _, r := range common[len(word):] {
+			e.insert(r)
+		}
+		return
+	}
+
+	io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+}
+
+// wordStart 返回line末尾待补全单词的起始位置，单词由标识符字符组成，位于行首时可以带上元命令的':'
+func wordStart(line []rune) int {
+	start := len(line)
+	for start > 0 && (line[start-1] == '_' || unicode.IsLetter(line[start-1]) || unicode.IsDigit(line[start-1])) {
+		start--
+	}
+	if start == 1 && line[0] == ':' {
+		start = 0
+	}
+	return start
+}
+
+// refresh 重新绘制提示符和当前行，并把光标移动到正确的位置
+func (e *editor) refresh() {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(e.prompt)
+	out.WriteString(string(e.buf))
+	out.WriteString("\x1b[K")
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+	io.WriteString(e.out, out.String())
+}
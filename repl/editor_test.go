@@ -0,0 +1,236 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readLines 用editor依次读取input中的每一行，直到出错
+func readLines(ed *editor) ([]string, error) {
+	var lines []string
+	for {
+		line, err := ed.ReadLine(PROMPT)
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "let x = 1\r", "let x = 1"},
+		{"line feed", "abc\n", "abc"},
+		{"ctrl-a", "bc\x01a\r", "abc"},
+		{"ctrl-e", "ac\x01\x06b\x05d\r", "abcd"},
+		{"arrow keys", "ac\x1b[Db\x1b[Cd\r", "abcd"},
+		{"home end", "b\x1b[Ha\x1b[Fc\r", "abc"},
+		{"backspace", "abx\x7fc\r", "abc"},
+		{"delete", "xabc\x01\x1b[3~\r", "abc"},
+		{"ctrl-k", "abcdef\x01\x06\x06\x06\x0b\r", "abc"},
+		{"ctrl-u", "xyzabc\x01\x06\x06\x06\x15\r", "abc"},
+		{"unicode", "é\x1b[Dx\r", "xé"},
+		{"ctrl-d deletes under cursor", "abxc\x1b[D\x1b[D\x04\r", "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ed := newEditor(strings.NewReader(tt.input), io.Discard, -1)
+			line, err := ed.ReadLine(PROMPT)
+			if err != nil {
+				t.Fatalf("ReadLine returned error: %s", err)
+			}
+			if line != tt.expected {
+				t.Errorf("wrong line. want=%q, got=%q", tt.expected, line)
+			}
+		})
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	// 上键取回上一行，下键回到正在编辑的内容；空行和重复的行不记录
+	input := "one\r\rtwo\rtwo\r\x1b[A\x1b[A\r" + "dr\x1b[A\x1b[B\x10\x0e\r"
+	ed := newEditor(strings.NewReader(input), io.Discard, -1)
+
+	lines, err := readLines(ed)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	expected := []string{"one", "", "two", "two", "one", "dr"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong lines. want=%q, got=%q", expected, lines)
+	}
+	if !reflect.DeepEqual(ed.history.lines, []string{"one", "two", "one", "dr"}) {
+		t.Errorf("wrong history. got=%q", ed.history.lines)
+	}
+}
+
+func TestEditorInterruptAndEOF(t *testing.T) {
+	ed := newEditor(strings.NewReader("abc\x03\x04"), io.Discard, -1)
+
+	if _, err := ed.ReadLine(PROMPT); err != errInterrupted {
+		t.Fatalf("expected errInterrupted, got %v", err)
+	}
+	if _, err := ed.ReadLine(PROMPT); err != io.EOF {
+		t.Fatalf("expected io.EOF on ctrl-d, got %v", err)
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	complete := func(word string) []string {
+		var out []string
+		for _, c := range []string{"len", "let", "push"} {
+			if strings.HasPrefix(c, word) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unique", "pu\t[]\r", "push []"},
+		{"common prefix", "l\t\r", "le"},
+		{"middle of line", "x + p\t1\r", "x + push 1"},
+		{"no candidates", "zz\t\r", "zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ed := newEditor(strings.NewReader(tt.input), io.Discard, -1)
+			ed.complete = complete
+			line, err := ed.ReadLine(PROMPT)
+			if err != nil {
+				t.Fatalf("ReadLine returned error: %s", err)
+			}
+			if line != tt.expected {
+				t.Errorf("wrong line. want=%q, got=%q", tt.expected, line)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	ed := newEditor(strings.NewReader("le\t\r"), &out, -1)
+	ed.complete = complete
+	if _, err := ed.ReadLine(PROMPT); err != nil {
+		t.Fatalf("ReadLine returned error: %s", err)
+	}
+	if !strings.Contains(out.String(), "len  let") {
+		t.Errorf("ambiguous completion did not list candidates. got=%q", out.String())
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	var h history
+	if err := h.load(path); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	h.add("let a = 1;")
+	h.add("a + 1")
+	if err := h.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新的会话可以取回之前的输入
+	ed := newEditor(strings.NewReader("\x1b[A\x1b[A\r"), io.Discard, -1)
+	if err := ed.history.load(path); err != nil {
+		t.Fatalf("reload failed: %s", err)
+	}
+	line, err := ed.ReadLine(PROMPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "let a = 1;" {
+		t.Errorf("history not restored. got=%q", line)
+	}
+	ed.Close()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "let a = 1;\na + 1\nlet a = 1;\n" {
+		t.Errorf("wrong history file content. got=%q", data)
+	}
+}
+
+func TestHistoryFileIsTrimmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var content strings.Builder
+	for i := 0; i < maxHistory+10; i++ {
+		content.WriteString("line\n")
+	}
+	content.WriteString("last\n")
+	os.WriteFile(path, []byte(content.String()), 0o600)
+
+	var h history
+	if err := h.load(path); err != nil {
+		t.Fatal(err)
+	}
+	h.close()
+
+	if len(h.lines) != maxHistory || h.lines[maxHistory-1] != "last" {
+		t.Fatalf("history not trimmed. len=%d", len(h.lines))
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "\n") != maxHistory {
+		t.Errorf("history file not trimmed. lines=%d", strings.Count(string(data), "\n"))
+	}
+}
+
+func TestWordStart(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"pu", "pu"},
+		{"let x = le", "le"},
+		{"{a:b", "b"},
+		{":lo", ":lo"},
+		{"x ", ""},
+	}
+
+	for _, tt := range tests {
+		line := []rune(tt.line)
+		if got := string(line[wordStart(line):]); got != tt.expected {
+			t.Errorf("wordStart(%q) = %q, want %q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestSessionComplete(t *testing.T) {
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			e, _ := newEngine(engineName)
+			s := &session{out: io.Discard, engineName: engineName, engine: e}
+			s.eval("let length = 1; let lemon = fn() {};", "")
+
+			tests := []struct {
+				word     string
+				expected []string
+			}{
+				{"le", []string{"lemon", "len", "length", "let"}},
+				{"wh", []string{"while"}},
+				{"pu", []string{"push"}},
+				{":re", []string{":reset"}},
+				{"zzz", nil},
+			}
+			for _, tt := range tests {
+				if got := s.complete(tt.word); !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("complete(%q) = %q, want %q", tt.word, got, tt.expected)
+				}
+			}
+		})
+	}
+}
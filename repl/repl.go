@@ -1,18 +1,30 @@
 package repl
 
 import (
+	"Monkey/ast"
 	"Monkey/compiler"
+	"Monkey/diagnostic"
+	"Monkey/evaluator"
 	"Monkey/lexer"
 	"Monkey/object"
-	"Monkey/parser"
+	"Monkey/token"
 	"Monkey/vm"
-	"bufio"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">>"
 
+// CONTINUE_PROMPT 输入的括号尚未闭合、需要继续读取下一行时的提示符
+const CONTINUE_PROMPT = ".."
+
+// 可选的执行引擎
+const (
+	EngineEval = "eval" // 树遍历求值器
+	EngineVM   = "vm"   // 编译器+虚拟机
+)
+
 // repl/repl.go
 
 const MONKEY_FACE = `            __,__
@@ -28,65 +40,266 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func Start(in io.Reader, out io.Writer) {
-	io.WriteString(out, MONKEY_FACE)
-	scanner := bufio.NewScanner(in)
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
+// engine 执行一次输入并输出结果，实现需要在多次输入之间保留状态
+type engine interface {
+	run(out io.Writer, src string, program *ast.Program)
+	// listGlobals 输出用户定义的全局绑定及其值
+	listGlobals(out io.Writer)
+	// bytecode 编译并输出program的字节码，不执行，也不修改引擎的状态
+	bytecode(out io.Writer, src string, program *ast.Program)
+	// names 当前定义的全局名称，用于补全
+	names() []string
+}
+
+// evalEngine 使用求值器执行，状态保存在环境中
+type evalEngine struct {
+	env *object.Environment
+}
+
+func newEvalEngine() *evalEngine {
+	return &evalEngine{env: object.NewEnvironment()}
+}
+
+func (e *evalEngine) run(out io.Writer, src string, program *ast.Program) {
+	evaluated := evaluator.Eval(program, e.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printError(out, src, errObj.Diagnostic())
+		return
+	}
+	if evaluated != nil {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
+}
+
+func (e *evalEngine) listGlobals(out io.Writer) {
+	for _, name := range e.env.Names() {
+		value, _ := e.env.Get(name)
+		fmt.Fprintf(out, "%s = %s\n", name, value.Inspect())
+	}
+}
+
+func (e *evalEngine) names() []string {
+	return e.env.Names()
+}
+
+func (e *evalEngine) bytecode(out io.Writer, src string, program *ast.Program) {
+	fmt.Fprintf(out, "bytecode is only available with the %s engine\n", EngineVM)
+}
+
+// vmEngine 使用编译器和虚拟机执行，状态保存在常量池、全局变量和符号表中
+type vmEngine struct {
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+}
+
+func newVMEngine() *vmEngine {
 	symbolTable := compiler.NewSymbolTable()
-	//env := object.NewEnvironment()
-	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &vmEngine{
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		symbolTable: symbolTable,
+	}
+}
+
+func (e *vmEngine) run(out io.Writer, src string, program *ast.Program) {
+	// 在符号表的副本上编译，编译失败时丢弃副本，
+	// 避免输入中已经编译的定义留在符号表中而对应的全局变量从未赋值
+	symbolTable := e.symbolTable.Clone()
+	comp := compiler.NewWithState(symbolTable, e.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		io.WriteString(out, "Woops!Compilation fail:\n")
+		printError(out, src, err)
+		return
+	}
+	code := comp.Bytecode()
+	e.symbolTable = symbolTable
+	e.constants = code.Constants
+
+	machine := vm.NewWithGlobalsStore(code, e.globals)
+	err = machine.Run()
+	if err != nil {
+		io.WriteString(out, "Woops!Executing bytecode failed:\n")
+		printError(out, src, err)
+		return
+	}
+
+	// 与求值器一致，只有以表达式或return结尾的输入才输出结果，
+	// 否则栈顶上只是let、循环等语句留下的旧值
+	if !endsWithValue(program) {
+		return
+	}
+	stackTop := machine.LastPoppedStackElem()
+	if stackTop != nil {
+		io.WriteString(out, stackTop.Inspect())
+		io.WriteString(out, "\n")
+	}
+}
+
+func (e *vmEngine) listGlobals(out io.Writer) {
+	for _, symbol := range e.symbolTable.Symbols() {
+		value := e.globals[symbol.Index]
+		if value == nil {
+			continue // 已经编译但还没有执行到的定义
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		fmt.Fprintf(out, "%s = %s\n", symbol.Name, value.Inspect())
+	}
+}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+func (e *vmEngine) names() []string {
+	var names []string
+	for _, symbol := range e.symbolTable.Symbols() {
+		names = append(names, symbol.Name)
+	}
+	return names
+}
+
+func (e *vmEngine) bytecode(out io.Writer, src string, program *ast.Program) {
+	// 在符号表副本上编译，限制常量池容量使追加时复制，避免影响后续的执行
+	existing := len(e.constants)
+	comp := compiler.NewWithState(e.symbolTable.Clone(), e.constants[:existing:existing])
+	if err := comp.Compile(program); err != nil {
+		printError(out, src, err)
+		return
+	}
+
+	code := comp.Bytecode()
+	io.WriteString(out, code.Instructions.String())
+	for i := existing; i < len(code.Constants); i++ {
+		switch constant := code.Constants[i].(type) {
+		case *object.CompiledFunction:
+			name := constant.Name
+			if name == "" {
+				name = diagnostic.AnonymousFunction
+			}
+			fmt.Fprintf(out, "constant %d: fn %s\n", i, name)
+			for _, line := range strings.Split(strings.TrimSuffix(constant.Instructions.String(), "\n"), "\n") {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		default:
+			fmt.Fprintf(out, "constant %d: %s %s\n", i, constant.Type(), constant.Inspect())
 		}
+	}
+}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Fprintf(out, "Woops!Compilation fail:\n%s\n", err)
+// endsWithValue 程序的最后一条语句是否产生值
+func endsWithValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+func newEngine(name string) (engine, error) {
+	switch name {
+	case EngineEval:
+		return newEvalEngine(), nil
+	case EngineVM:
+		return newVMEngine(), nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q, want %q or %q", name, EngineEval, EngineVM)
+	}
+}
+
+// Start 启动REPL，engineName为EngineEval或EngineVM
+func Start(in io.Reader, out io.Writer, engineName string) error {
+	e, err := newEngine(engineName)
+	if err != nil {
+		return err
+	}
+
+	s := &session{out: out, engineName: engineName, engine: e}
+
+	reader := newLineReader(in, out, s.complete)
+	defer reader.Close()
+
+	io.WriteString(out, MONKEY_FACE)
+	var pending []string // 尚未执行的多行输入
+	for {
+		prompt := PROMPT
+		if len(pending) != 0 {
+			prompt = CONTINUE_PROMPT
+		}
+		line, err := reader.ReadLine(prompt)
+		if err == errInterrupted {
+			pending = nil
 			continue
 		}
-		code := comp.Bytecode()
-		machine := vm.NewWithGlobalsStore(code, globals)
-		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "Woops!Executing bytecode failed:\n%s\n", err)
-			continue
+			// 输入结束时执行剩余的输入，让用户看到未闭合的错误
+			if len(pending) != 0 {
+				s.eval(strings.Join(pending, "\n"), "")
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
 		}
 
-		stackTop := machine.LastPoppedStackElem()
-		io.WriteString(out, stackTop.Inspect())
-		io.WriteString(out, "\n")
-		//evaluated := evaluator.Eval(program, env)
-		//if evaluated != nil {
-		//	io.WriteString(out, evaluated.Inspect())
-		//	io.WriteString(out, "\n")
-		//}
-		//for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-		//	fmt.Fprintf(out, "%+v\n", tok)
-		//}
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if len(pending) == 0 {
+				if !s.command(line) {
+					return nil
+				}
+				continue
+			}
+			if strings.TrimSpace(line) == ":cancel" {
+				pending = nil
+				continue
+			}
+		}
 
+		pending = append(pending, line)
+		src := strings.Join(pending, "\n")
+		if needsMoreInput(src) {
+			continue
+		}
+		pending = nil
+		s.eval(src, "")
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+// needsMoreInput 判断输入是否还没有结束：括号没有闭合，或者字符串、块注释没有结束
+// 多出的右括号不需要更多输入，交给语法分析报错
+func needsMoreInput(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBARACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBARACKET:
+			depth--
+		case token.ERROR:
+			return strings.HasPrefix(tok.Literal, "unterminated")
+		case token.EOF:
+			return depth > 0
+		}
+	}
+}
 
+func printParserErrors(out io.Writer, src string, diags []*diagnostic.Diagnostic) {
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+""+
-			"\n")
-	}
+	diagnostic.Render(out, src, diags)
+}
 
+// printError 诊断信息附带源码和标记输出，其它错误直接输出
+func printError(out io.Writer, src string, err error) {
+	if d, ok := err.(*diagnostic.Diagnostic); ok {
+		diagnostic.Render(out, src, []*diagnostic.Diagnostic{d})
+		return
+	}
+	fmt.Fprintf(out, "%s\n", err)
 }
@@ -0,0 +1,243 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartKeepsStateAcrossLines(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let x = 40;
+add(x, 2)
+`
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Start(strings.NewReader(input), &out, engineName)
+			if err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			if !strings.Contains(out.String(), PROMPT+"42\n") {
+				t.Errorf("output does not contain result 42. got=%q", out.String())
+			}
+		})
+	}
+}
+
+func TestStartUnknownEngine(t *testing.T) {
+	var out bytes.Buffer
+	err := Start(strings.NewReader(""), &out, "jit")
+	if err == nil {
+		t.Fatalf("expected error for unknown engine")
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output for unknown engine: %q", out.String())
+	}
+}
+
+func TestStartReadsMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  let sum = a + b;
+
+  sum
+};
+let s = "two
+lines";
+add(len(s), [
+  1,
+  2
+][1])
+`
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Start(strings.NewReader(input), &out, engineName); err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			if strings.Contains(out.String(), "Woops") {
+				t.Fatalf("unexpected error in output: %q", out.String())
+			}
+			if !strings.Contains(out.String(), CONTINUE_PROMPT+"11\n") {
+				t.Errorf("output does not contain result 11. got=%q", out.String())
+			}
+		})
+	}
+}
+
+func TestNeedsMoreInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"fn(x) {", true},
+		{"fn(x) {\n x }", false},
+		{"[1, (2", true},
+		{"let s = \"open", true},
+		{"/* comment", true},
+		{"1 }", false},
+		{"\"}\" + \"{\"", false},
+		{"// {", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := needsMoreInput(tt.input); got != tt.expected {
+				t.Errorf("needsMoreInput(%q) = %t, want %t", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		engines  []string
+	}{
+		{"tokens", ":tokens let x = 1;\n", []string{`1:1    LET        "let"`, `1:9    INT        "1"`}, nil},
+		{"ast", ":ast 1 + 2 * 3\n", []string{"(1 + (2 * 3))\n"}, nil},
+		{"usage", ":ast\n", []string{"usage: :ast <code>\n"}, nil},
+		{"unknown", ":nope\n", []string{"unknown command :nope"}, nil},
+		{"globals", "let a = 1;\nlet b = \"x\";\n:globals\n", []string{"a = 1\nb = x\n"}, nil},
+		{"cancel", "let a = [1,\n:cancel\n2\n", []string{CONTINUE_PROMPT + PROMPT + "2\n"}, nil},
+		{
+			"bytecode",
+			"let one = 1;\n:bytecode fn(x) { x + one }(2)\n:globals\n",
+			[]string{
+				"0000 OpClosure 1 0\n0004 OpConstant 2\n0007 OpCall 1\n0009 OpPop\n",
+				"constant 1: fn <anonymous>\n    0000 OpGetLocal 0\n    0002 OpGetGlobal 0\n",
+				"constant 2: INTEGER 2\n",
+				PROMPT + "one = 1\n" + PROMPT,
+			},
+			[]string{EngineVM},
+		},
+		{"bytecode eval", ":bytecode 1\n", []string{"bytecode is only available with the vm engine"}, []string{EngineEval}},
+	}
+
+	for _, tt := range tests {
+		engines := tt.engines
+		if engines == nil {
+			engines = []string{EngineEval, EngineVM}
+		}
+		for _, engineName := range engines {
+			t.Run(tt.name+"/"+engineName, func(t *testing.T) {
+				var out bytes.Buffer
+				if err := Start(strings.NewReader(tt.input), &out, engineName); err != nil {
+					t.Fatalf("Start returned error: %s", err)
+				}
+				for _, want := range tt.expected {
+					if !strings.Contains(out.String(), want) {
+						t.Errorf("output does not contain %q. got=%q", want, out.String())
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestResetClearsBindings(t *testing.T) {
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Start(strings.NewReader("let a = 1;\n:reset\na\n"), &out, engineName); err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			if !strings.Contains(out.String(), "session reset\n") {
+				t.Fatalf("reset not acknowledged. got=%q", out.String())
+			}
+			if !strings.Contains(out.String(), "identifier not found: a") && !strings.Contains(out.String(), "undefined variable: a") {
+				t.Errorf("binding survived :reset. got=%q", out.String())
+			}
+		})
+	}
+}
+
+func TestQuitStopsReading(t *testing.T) {
+	var out bytes.Buffer
+	if err := Start(strings.NewReader(":quit\n40 + 2\n"), &out, EngineVM); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	if strings.Contains(out.String(), "42") {
+		t.Errorf("input after :quit was executed. got=%q", out.String())
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.mk")
+	src := "// helper\nlet double = fn(x) {\n  x * 2\n};\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			input := ":load " + path + "\ndouble(21)\n:load missing.mk\n"
+			if err := Start(strings.NewReader(input), &out, engineName); err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			if !strings.Contains(out.String(), PROMPT+"42\n") {
+				t.Errorf("loaded function not available. got=%q", out.String())
+			}
+			if !strings.Contains(out.String(), "missing.mk") {
+				t.Errorf("missing file not reported. got=%q", out.String())
+			}
+		})
+	}
+}
+
+func TestSelfReferencingLetIsAnError(t *testing.T) {
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Start(strings.NewReader("let x = x + 1;\nlet y = 2;\ny + 1\n"), &out, engineName); err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			if !strings.Contains(out.String(), "identifier not found: x") && !strings.Contains(out.String(), "undefined variable: x") {
+				t.Errorf("self reference not reported. got=%q", out.String())
+			}
+			if !strings.Contains(out.String(), PROMPT+"3\n") {
+				t.Errorf("session did not continue after the error. got=%q", out.String())
+			}
+		})
+	}
+}
+
+func TestCompileErrorDiscardsDefinitions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.mk")
+	if err := os.WriteFile(path, []byte("let r = 2;\nmissing;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	input := "let q = 1; undefinedThing;\nq + 1\n:load " + path + "\nr + 1\n1 + 1\n"
+	if err := Start(strings.NewReader(input), &out, EngineVM); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	for _, expected := range []string{"undefined variable: q", "undefined variable: r", PROMPT + "2\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output does not contain %q. got=%q", expected, out.String())
+		}
+	}
+}
+
+func TestStatementsDoNotEchoValues(t *testing.T) {
+	input := "for (x in [1, 2]) { x }\nlet y = 3;\nwhile (false) {}\ny\n"
+	for _, engineName := range []string{EngineEval, EngineVM} {
+		t.Run(engineName, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Start(strings.NewReader(input), &out, engineName); err != nil {
+				t.Fatalf("Start returned error: %s", err)
+			}
+			expected := strings.Repeat(PROMPT, 4) + "3\n" + PROMPT
+			if !strings.HasSuffix(out.String(), expected) {
+				t.Errorf("wrong output. want suffix %q, got=%q", expected, out.String())
+			}
+		})
+	}
+}
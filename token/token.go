@@ -1,10 +1,47 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // 词法单元第一个字符在源码中的位置
+}
+
+// Comment 源码中的注释，词法分析器默认丢弃，开启记录后供格式化工具等保留原样
+type Comment struct {
+	Text  string   // 包含注释符号本身，如"// note"或"/* note */"，行注释不含结尾的换行
+	Pos   Position // 注释第一个字符的位置
+	Block bool     // 是否为/* */块注释
+}
+
+// Position 源码中的位置，Line和Column从1开始，Column按字符（rune）计数，Offset为字节偏移
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+// IsValid 零值Position表示位置未知
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 // token/token.go
@@ -12,10 +49,12 @@ type Token struct {
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	ERROR   = "ERROR" // 词法错误，如未闭合的字符串，Literal为错误信息
 
 	// 标识符+字面量
 	IDENT = "IDENT" // add, foobar, x, y, ...
 	INT   = "INT"   // 1343456
+	FLOAT = "FLOAT" // 3.14, 1e-9
 
 	// 运算符
 	ASSIGN   = "="
@@ -28,6 +67,17 @@ const (
 	NOT_EQ   = "!="
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
+	PERCENT  = "%"
+	AND      = "&&"
+	OR       = "||"
+
+	// 赋值运算符
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 	// 分隔符
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -45,6 +95,11 @@ const (
 	RETURN   = "RETURN"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	WHILE    = "WHILE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	FOR      = "FOR"
+	IN       = "IN"
 	STRING   = "STRING"
 	//array
 	LBARACKET = "["
@@ -54,8 +109,13 @@ const (
 )
 
 var keywords = map[string]TokenType{
-	"fn":  FUNCTION,
-	"let": LET,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"for":      FOR,
+	"in":       IN,
 }
 
 func LoopupIdent(s string) TokenType {
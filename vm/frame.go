@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"Monkey/code"
+	"Monkey/object"
+)
+
+// Frame 调用帧，保存一次函数调用的执行状态
+type Frame struct {
+	cl          *object.Closure
+	ip          int // 当前帧的指令指针
+	basePointer int // 调用前的栈指针，局部绑定存放在basePointer之上
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
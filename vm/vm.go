@@ -3,20 +3,26 @@ package vm
 import (
 	"Monkey/code"
 	"Monkey/compiler"
+	"Monkey/diagnostic"
 	"Monkey/object"
 	"fmt"
+	"math"
+	"math/big"
 )
 
 const StackSize = 2048
 const GlobalsSize = 65536
+const MaxFrames = 1024
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	constants []object.Object
 
 	stack   []object.Object
 	sp      int // 指向栈顶下一个位置的指针
 	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int // 指向下一个空闲帧的位置
 }
 
 var True = &object.Boolean{Value: true}
@@ -24,12 +30,25 @@ var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
 
 func New(bytecode *compiler.Bytecode) *VM {
+	// 顶层指令也作为一个函数，放在第一个帧中执行
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		Name:         diagnostic.MainFunction,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		instructions: bytecode.Instructions,
-		constants:    bytecode.Constants,
-		stack:        make([]object.Object, StackSize),
-		sp:           0,
-		globals:      make([]object.Object, GlobalsSize),
+		constants:   bytecode.Constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		frames:      frames,
+		framesIndex: 1,
 	}
 }
 
@@ -40,19 +59,76 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 
 }
 
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		return fmt.Errorf("frame overflow")
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run 执行字节码，运行时错误为*diagnostic.Diagnostic，位置为出错指令对应的源码位置
+// 并附带出错时的调用栈
 func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := code.Opcode(vm.instructions[ip])
+	err := vm.run()
+	if err != nil {
+		trace := vm.stackTrace()
+		d := diagnostic.Errorf(diagnostic.PosSpan(trace[0].Pos), "%s", err)
+		d.Trace = trace
+		return d
+	}
+	return nil
+}
+
+// stackTrace 从当前帧向外收集调用栈，外层帧的ip停在调用指令上
+func (vm *VM) stackTrace() []diagnostic.StackFrame {
+	trace := make([]diagnostic.StackFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		name := frame.cl.Fn.Name
+		if name == "" {
+			name = diagnostic.AnonymousFunction
+		}
+		trace = append(trace, diagnostic.StackFrame{
+			Function: name,
+			Pos:      frame.cl.Fn.SourceMap.Lookup(frame.ip),
+		})
+	}
+	return trace
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
 		// 直接取op并转化为操作码，而不是使用lookup，因为这会很慢
 		switch op {
 		case code.OpConstant:
-			constIndex := code.ReadUnit16(vm.instructions[ip+1:]) //ReadUnit16期望读取两个字节，因此不用特地使用[ip+1:ip+3]
-			ip += 2
+			constIndex := code.ReadUnit16(ins[ip+1:]) //ReadUnit16期望读取两个字节，因此不用特地使用[ip+1:ip+3]
+			vm.currentFrame().ip += 2
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpNotEqual, code.OpEqual, code.OpGreaterThan:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpNotEqual, code.OpEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -65,7 +141,7 @@ func (vm *VM) Run() error {
 		case code.OpFalse:
 			err := vm.push(False)
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpBang:
 			err := vm.executeBangOperator()
@@ -78,14 +154,14 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpJump:
-			pos := int(code.ReadUnit16(vm.instructions[ip+1:]))
-			ip = pos - 1 // pos减一是因为循环的时候还会加一
+			pos := int(code.ReadUnit16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1 // pos减一是因为循环的时候还会加一
 		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUnit16(vm.instructions[ip+1:]))
-			ip += 2
+			pos := int(code.ReadUnit16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 			condition := vm.pop()
 			if !isTruthy(condition) {
-				ip = pos - 1
+				vm.currentFrame().ip = pos - 1
 			}
 		case code.OpNull:
 			err := vm.push(Null)
@@ -93,16 +169,219 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpSetGlobal:
-			globalIndex := code.ReadUnit16(vm.instructions[ip+1:])
-			ip += 2
+			globalIndex := code.ReadUnit16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 			vm.globals[globalIndex] = vm.pop()
 		case code.OpGetGlobal:
-			globalIndex := code.ReadUnit16(vm.instructions[ip+1:])
-			ip += 2
+			globalIndex := code.ReadUnit16(ins[ip+1:])
+			vm.currentFrame().ip += 2
 			err := vm.push(vm.globals[globalIndex])
 			if err != nil {
 				return err
 			}
+		case code.OpArray:
+			numElements := int(code.ReadUnit16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUnit16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+		case code.OpIter:
+			obj := vm.pop()
+			iterable, ok := obj.(object.Iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", obj.Type())
+			}
+			err := vm.push(iterable.Iterator())
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUnit16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it, ok := vm.stack[vm.sp-1].(object.Iterator)
+			if !ok {
+				return fmt.Errorf("expected an iterator on the stack, got %s", vm.stack[vm.sp-1].Type())
+			}
+			key, value, ok := it.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+			err := vm.push(key)
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			// 顶层的return结束整个程序，返回值留在刚弹出的位置上作为程序的结果
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// 减一是为了同时弹出栈上的被调函数
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = Null
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			if cell, ok := vm.stack[slot].(*object.Cell); ok {
+				// 已被闭包捕获的变量，修改共享的Cell
+				cell.Value = vm.pop()
+			} else {
+				vm.stack[slot] = vm.pop()
+			}
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(deref(vm.stack[frame.basePointer+int(localIndex)]))
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			cell, ok := vm.stack[slot].(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: vm.stack[slot]}
+				vm.stack[slot] = cell
+			}
+			err := vm.push(cell)
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUnit16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(deref(currentClosure.Free[freeIndex]))
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			if cell, ok := currentClosure.Free[freeIndex].(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				currentClosure.Free[freeIndex] = vm.pop()
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpDup2:
+			err := vm.push(vm.stack[vm.sp-2])
+			if err != nil {
+				return err
+			}
+			err = vm.push(vm.stack[vm.sp-2])
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
 		case code.OpPop:
 			vm.pop()
 		}
@@ -145,8 +424,14 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isInteger(left) && isInteger(right):
+		return vm.executeBinaryBigIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == object.BOOLEAN_OBJ && rightType == object.BOOLEAN_OBJ:
 		return vm.executeBinaryBooleanOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
 	default:
 		return fmt.Errorf("unsupport types for binary operation: %s %s", leftType, rightType)
 	}
@@ -160,13 +445,22 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left object.Object,
 
 	switch op {
 	case code.OpAdd:
-		result = leftValue + rightValue
+		return vm.push(object.AddInt(leftValue, rightValue))
 	case code.OpSub:
-		result = leftValue - rightValue
+		return vm.push(object.SubInt(leftValue, rightValue))
 	case code.OpDiv:
-		result = leftValue / rightValue
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(object.DivInt(leftValue, rightValue))
 	case code.OpMul:
-		result = leftValue * rightValue
+		return vm.push(object.MulInt(leftValue, rightValue))
+	case code.OpMod:
+		// math.MinInt64 % -1在Go中结果为0，不会溢出
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue % rightValue
 	case code.OpEqual:
 		if leftValue == rightValue {
 			return vm.push(True)
@@ -185,11 +479,87 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left object.Object,
 		} else {
 			return vm.push(False)
 		}
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unkonwn integer operator:%d", op)
+	}
+	return vm.push(&object.Integer{Value: result})
+}
+
+func isInteger(obj object.Object) bool {
+	_, ok := object.AsBigInt(obj)
+	return ok
+}
 
+// executeBinaryBigIntegerOperation 至少一侧为大整数时按任意精度运算，结果重新规范化
+// 除法和取余与int64一致，向零取整
+func (vm *VM) executeBinaryBigIntegerOperation(op code.Opcode, left object.Object, right object.Object) error {
+	leftValue, _ := object.AsBigInt(left)
+	rightValue, _ := object.AsBigInt(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(object.NewInteger(new(big.Int).Add(leftValue, rightValue)))
+	case code.OpSub:
+		return vm.push(object.NewInteger(new(big.Int).Sub(leftValue, rightValue)))
+	case code.OpMul:
+		return vm.push(object.NewInteger(new(big.Int).Mul(leftValue, rightValue)))
+	case code.OpDiv:
+		if rightValue.Sign() == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(object.NewInteger(new(big.Int).Quo(leftValue, rightValue)))
+	case code.OpMod:
+		if rightValue.Sign() == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(object.NewInteger(new(big.Int).Rem(leftValue, rightValue)))
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue.Cmp(rightValue) >= 0))
 	default:
 		return fmt.Errorf("unkonwn integer operator:%d", op)
 	}
-	return vm.push(&object.Integer{result})
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := object.AsFloat(obj)
+	return ok
+}
+
+// executeBinaryFloatOperation 至少一侧为浮点数时，整数先提升为浮点数再运算
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left object.Object, right object.Object) error {
+	leftValue, _ := object.AsFloat(left)
+	rightValue, _ := object.AsFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unkonwn float operator:%d", op)
+	}
 }
 
 func (vm *VM) executeBangOperator() error {
@@ -209,11 +579,16 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(object.NegInt(operand.Value))
+	case *object.BigInt:
+		return vm.push(object.NewInteger(new(big.Int).Neg(operand.Value)))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation:%s", operand.Type())
 	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{-value})
 }
 func (vm *VM) executeBinaryBooleanOperation(op code.Opcode, left object.Object, right object.Object) error {
 	leftValue := left.(*object.Boolean).Value
@@ -236,6 +611,214 @@ func (vm *VM) executeBinaryBooleanOperation(op code.Opcode, left object.Object,
 	}
 }
 
+// executeBinaryStringOperation 字符串支持拼接和比较操作
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left object.Object, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	// 比较运算按字节逐个比较，即UTF-8编码下的字典序
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown string operator: %d", op)
+	}
+}
+
+// buildArray 用栈上[startIndex, endIndex)区间的元素构建数组
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+	return &object.Array{Elements: elements}
+}
+
+// buildHash 用栈上[startIndex, endIndex)区间的元素构建哈希表，键和值交替存放
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+// executeSetIndex 原地修改数组或哈希表中的元素
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+// executeArrayIndex 越界访问时返回Null，与求值器保持一致
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	maxId := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > maxId {
+		return vm.push(Null)
+	}
+	return vm.push(arrayObject.Elements[idx])
+}
+
+// executeStringIndex 按字符（rune）下标取值，越界时返回Null
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(char)
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(pair.Value)
+}
+
+// executeCall 调用栈上位于实参之下的函数
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+// callClosure 实参已经在栈上，正好作为被调函数的前几个局部绑定
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	// 为局部绑定预留空间，先检查再压帧，出错时调用栈停留在调用位置
+	if frame.basePointer+fn.NumLocals >= len(vm.stack) {
+		return fmt.Errorf("stack overflow")
+	}
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+	vm.sp = frame.basePointer + fn.NumLocals
+	// 清空上一次调用残留在局部变量槽位中的值，避免误用其中的Cell
+	for i := vm.sp - fn.NumLocals + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	return nil
+}
+
+// deref 读取被闭包捕获的变量时取出Cell中的值
+func deref(obj object.Object) object.Object {
+	if cell, ok := obj.(*object.Cell); ok {
+		return cell.Value
+	}
+	return obj
+}
+
+// pushClosure 用常量池中的函数和栈顶的numFree个自由变量创建闭包
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// callBuiltin 内置函数返回的*object.Error会转换为虚拟机错误
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	if result == nil {
+		return vm.push(Null)
+	}
+	return vm.push(result)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Boolean:
@@ -2,11 +2,15 @@ package vm
 
 import (
 	"Monkey/ast"
+	"Monkey/code"
 	"Monkey/compiler"
+	"Monkey/diagnostic"
 	"Monkey/lexer"
 	"Monkey/object"
 	"Monkey/parser"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -38,6 +42,30 @@ func runVmTests(t *testing.T, tt vmTestCase) {
 
 }
 
+// runVmErrorTest 期望虚拟机执行input时返回指定的错误
+func runVmErrorTest(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler fail.%s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	d, ok := err.(*diagnostic.Diagnostic)
+	if !ok {
+		t.Fatalf("VM error is not *diagnostic.Diagnostic. got=%T (%+v)", err, err)
+	}
+	if d.Message != expected {
+		t.Fatalf("wrong VM error: want=%q, got=%q", expected, d.Message)
+	}
+}
+
 func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 
 	switch expected := expected.(type) {
@@ -46,11 +74,61 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 		if err != nil {
 			t.Fatalf("testIntegerObject failed:%s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Fatalf("testFloatObject failed:%s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
 			t.Fatalf("testBooleanObject failed:%s", err)
 		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Fatalf("testStringObject failed:%s", err)
+		}
+	case *big.Int:
+		result, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Fatalf("object is not BigInt. got=%T (%+v)", actual, actual)
+		}
+		if result.Value.Cmp(expected) != 0 {
+			t.Fatalf("object has wrong value. got=%s, want=%s", result.Value, expected)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Fatalf("object not Array: %T (%+v)", actual, actual)
+		}
+		if len(array.Elements) != len(expected) {
+			t.Fatalf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		}
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Fatalf("testIntegerObject failed:%s", err)
+			}
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Fatalf("object is not Hash. got=%T (%+v)", actual, actual)
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Fatalf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+		}
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Fatalf("no pair for given key in Pairs")
+			}
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Fatalf("testIntegerObject failed:%s", err)
+			}
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("object is not Null :%T(%+v)", actual, actual)
@@ -81,6 +159,30 @@ func testBooleanObject(expected bool, actual object.Object) error {
 	}
 	return nil
 }
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not float. got =%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got =%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+	return nil
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -108,6 +210,9 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"10 % 5 + 2 * 3 % 4", 2},
 	}
 
 	for _, tt := range tests {
@@ -160,6 +265,121 @@ func TestBooleanExpressions(t *testing.T) {
 	}
 }
 
+func TestLogicalExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "true && true", expected: true},
+		{input: "true && false", expected: false},
+		{input: "false && true", expected: false},
+		{input: "false || false", expected: false},
+		{input: "false || true", expected: true},
+		{input: "true || false", expected: true},
+		{input: "1 && \"a\"", expected: true},
+		{input: "1 > 2 || 3 > 2 && 2 > 1", expected: true},
+		{input: "false && [][0]()", expected: false},
+		{input: "true || [][0]()", expected: true},
+		{input: "let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); n == 0", expected: true},
+		{input: "let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); n == 2", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500.0},
+		{"-1.5", -1.5},
+		{"1.5 + 2", 3.5},
+		{"2 * 1.25", 2.5},
+		{"1 / 2.0", 0.5},
+		{"7.5 % 2", 1.5},
+		{"0.1 + 0.2 - 0.3 < 1e-15", true},
+		{"1 == 1.0", true},
+		{"2.5 > 2", true},
+		{"2 >= 2.5", false},
+		{"float(2)", 2.0},
+		{"float(\"1.5e3\")", 1500.0},
+		{"int(-3.9)", -3},
+		{"int(3.9)", 3},
+		{"int(\"42\")", 42},
+		{"int(7)", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestBigIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any // 字符串表示期望得到大整数
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-9223372036854775807 * -2", "18446744073709551614"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001"},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"(9223372036854775807 + 1) / 2", 4611686018427387904},
+		{"-99999999999999999999 % 7", -1},
+		{"9223372036854775807 + 1 > 9223372036854775807", true},
+		{"99999999999999999999 == 99999999999999999998 + 1", true},
+		{"99999999999999999999 != 1", true},
+		{"let h = {99999999999999999999: 1}; h[99999999999999999998 + 1]", 1},
+		{"99999999999999999999 * 1.0", 1e20},
+		{"int(\"99999999999999999999\")", "99999999999999999999"},
+		{"int(1e20)", "100000000000000000000"},
+		{"float(99999999999999999999)", 1e20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expected := tt.expected
+			if s, ok := expected.(string); ok {
+				expected, _ = new(big.Int).SetString(s, 10)
+			}
+			runVmTests(t, vmTestCase{input: tt.input, expected: expected})
+		})
+	}
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "1 <= 2", expected: true},
+		{input: "2 <= 2", expected: true},
+		{input: "3 <= 2", expected: false},
+		{input: "1 >= 2", expected: false},
+		{input: "2 >= 2", expected: true},
+		{input: "3 >= 2", expected: true},
+		{input: "1 + 1 >= 2 == true", expected: true},
+		{input: "\"a\" < \"b\"", expected: true},
+		{input: "\"b\" < \"a\"", expected: false},
+		{input: "\"abc\" > \"abd\"", expected: false},
+		{input: "\"ab\" < \"abc\"", expected: true},
+		{input: "\"Z\" < \"a\"", expected: true},
+		{input: "\"b\" >= \"b\"", expected: true},
+		{input: "\"a\" <= \"B\"", expected: false},
+		{input: "\"mon\" + \"key\" == \"monkey\"", expected: true},
+		{input: "\"a\" != \"a\"", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -169,8 +389,8 @@ func TestConditionals(t *testing.T) {
 		{"if (1 < 2) { 10 }", 10},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if(1>2}{10}", Null},
-		{"if(false){10}}", Null},
+		{"if(1>2){10}", Null},
+		{"if(false){10}", Null},
 	}
 
 	for _, tt := range tests {
@@ -193,3 +413,567 @@ func TestGlobalLetStatements(t *testing.T) {
 		})
 	}
 }
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`let s = "mon"; s + "key"`, "monkey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a\nb"`, "a\nb"},
+		{`"tab\there"`, "tab\there"},
+		{`"say \"hi\""`, "say \"hi\""},
+		{`"back\\slash"`, "back\\slash"},
+		{`"caf\u00e9"`, "café"},
+		{`"\u{1F600}"`, "😀"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`let s = "😀x"; s[1]`, "x"},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`len("\u{1F600}")`, 1},
+		{`"héllo"[5]`, Null},
+		{`"abc"[-1]`, Null},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"let arr = [1, 2, 3]; arr[0] + arr[2]", 4},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{"{1: 2, 2: 3}", map[object.HashKey]int64{
+			(&object.Integer{Value: 1}).HashKey(): 2,
+			(&object.Integer{Value: 2}).HashKey(): 3,
+		}},
+		{"{1 + 1: 2 * 2, 3 + 3: 4 * 4}", map[object.HashKey]int64{
+			(&object.Integer{Value: 2}).HashKey(): 4,
+			(&object.Integer{Value: 6}).HashKey(): 16,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"one": 1, true: 2}["one"]`, 1},
+		{`{"one": 1, true: 2}[true]`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestHashKeyErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{"{1: 2}[[1]]", "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmErrorTest(t, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { 2; }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c();", 3},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let earlyExit = fn() { return 99; return 100; }; earlyExit();", 99},
+		{"let nested = fn() { if (true) { if (true) { return 10; } return 1; } }; nested();", 10},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();", 3},
+		{`let firstFoobar = fn() { let foobar = 50; foobar; };
+		let secondFoobar = fn() { let foobar = 100; foobar; };
+		firstFoobar() + secondFoobar();`, 150},
+		{`let globalSeed = 50;
+		let minusOne = fn() { let num = 1; globalSeed - num; }
+		let minusTwo = fn() { let num = 2; globalSeed - num; }
+		minusOne() + minusTwo();`, 97},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { a + b; }; sum(1, 2);", 3},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{`let globalNum = 10;
+		let sum = fn(a, b) { let c = a + b; c + globalNum; };
+		let outer = fn() { sum(1, 2) + sum(3, 4) + globalNum; };
+		outer() + globalNum;`, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+		{"1();", "calling non-function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmErrorTest(t, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`println("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`push([1], 2)`, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`range()`, "wrong number of arguments. got=0, want=1..3"},
+		{`range("a")`, "arguments to `range` must be INTEGER, got STRING"},
+		{`range(0, 5, 0)`, "`range` step must not be zero"},
+		{`for (x in 1) { x }`, "cannot iterate over INTEGER"},
+		{`int("1.5")`, "could not parse \"1.5\" as INTEGER"},
+		{`int(1 / 0.0)`, "cannot convert +Inf to INTEGER"},
+		{`float("abc")`, "could not parse \"abc\" as FLOAT"},
+		{`float([])`, "argument to `float` not supported, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmErrorTest(t, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();`, 99},
+		{`let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);`, 11},
+		{`let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);`, 11},
+		{`let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2)
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{`let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+		};
+		let closure = newClosure(9, 90);
+		closure();`, 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`let countDown = fn(x) {
+			if (x == 0) { return 0; } else { countDown(x - 1); }
+		};
+		countDown(1);`, 0},
+		{`let wrapper = fn() {
+			let countDown = fn(x) {
+				if (x == 0) { return 0; } else { countDown(x - 1); }
+			};
+			countDown(1);
+		};
+		wrapper();`, 0},
+		{`let fibonacci = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);`, 610},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+// TestLetShadowing let的值在定义名称之前编译，引用的同名变量是外层或之前的绑定
+func TestLetShadowing(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1; let f = fn() { let x = x + 10; x }; f()", 11},
+		{"let x = 1; let f = fn(x) { let g = fn() { let x = x * 3; x }; g() }; f(5)", 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 5; 10", 5},
+		{"let f = fn() { 1 }; if (true) { return f() + 1; } 99", 2},
+		{"for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0", 20},
+		{"let i = 0; while (true) { i += 1; if (i == 3) { return i; } }", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let i = 0; while (i < 10) { let i = i + 1; }; i", expected: 10},
+		{input: "let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i", expected: 5},
+		{input: "let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 3) { continue; } let s = s + i; }; s", expected: 12},
+		{input: "let i = 0; let n = 0; while (i < 3) { let i = i + 1; let j = 0; while (true) { let j = j + 1; if (j > 2) { break; } let n = n + 1; } }; n", expected: 6},
+		{input: "let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 7) { return i; } } }; f()", expected: 7},
+		{input: "let i = 0; while (i < 100000) { let i = i + 1; }; i", expected: 100000},
+		{input: "let f = fn() { let i = 0; while (i < 3) { let i = i + 1; if (true) { let k = i; } } i }; f()", expected: 3},
+		{input: "let f = fn() { while (false) { 1 } }; f()", expected: Null},
+		// 表达式中的continue每次迭代都弹出已经压入的操作数，不会累积到栈溢出
+		{input: "let i = 0; while (i < 5000) { i += 1; let y = 1 + if (i > 0) { continue; } else { 0 }; }; i", expected: 5000},
+		{input: "let i = 0; let r = 0; while (true) { i += 1; r = [i, if (i == 3) { break; } else { i }][1]; }; r", expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", expected: 6},
+		{input: "let s = 0; for (i, x in [10, 20, 30]) { let s = s + i * x; }; s", expected: 80},
+		{input: "let s = 0; for (k, v in {3: 1, 1: 2, 2: 3}) { let s = s * 10 + v; }; s", expected: 231},
+		{input: "let s = 0; for (k in {1: 5, 2: 6}) { let s = s + k; }; s", expected: 11},
+		{input: "let n = 0; for (i, c in \"héllo\") { let n = n + i; }; n", expected: 10},
+		{input: "let s = 0; for (x in range(5)) { if (x == 1) { continue; } if (x == 4) { break; } let s = s + x; }; s", expected: 5},
+		{input: "let s = 0; for (x in range(10, 0, -3)) { let s = s + x; }; s", expected: 22},
+		{input: "let f = fn() { for (x in range(1, 100)) { if (x * x > 50) { return x; } } }; f()", expected: 8},
+		{input: "let s = 0; for (x in range(3)) { for (y in range(3)) { if (y > x) { break; } let s = s + 1; } }; s", expected: 6},
+		{input: "fn() { for (x in [1]) {} }()", expected: Null},
+		{input: "let f = fn() { for (x in [1]) { x } }; f()", expected: Null},
+		{input: "if (true) { for (x in [1]) {} }", expected: Null},
+		{input: "let r = if (false) { 1 } else { for (k, v in {1: 2}) {} }; r", expected: Null},
+		// 表达式中的break和continue先弹出已经压入栈中的操作数
+		{input: "let s = 0; for (x in [1, 2, 3]) { let y = 1 + if (x == 1) { continue; } else { x }; s += y; }; s", expected: 7},
+		{input: "let s = 0; for (x in [1, 2, 3]) { s += len([x, if (x == 2) { break; } else { x }]); }; s", expected: 2},
+		{input: "let a = [0]; for (x in [1, 2, 3]) { a[0] += {x: if (x == 2) { continue; } else { x }}[x]; }; a[0]", expected: 4},
+		{input: "let f = fn(a, b) { a + b }; let s = 0; for (x in range(3)) { s = s + f(x, if (x == 1) { continue; } else { 10 }); }; s", expected: 22},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+// TestLocalIndexLimit 局部变量的下标只有一个字节，最后一个下标255仍要取到正确的槽位
+func TestLocalIndexLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("fn() { ")
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "let v%c%c = %d; ", 'a'+i/26, 'a'+i%26, i)
+	}
+	b.WriteString("vaa + vjv }()")
+
+	runVmTests(t, vmTestCase{input: b.String(), expected: 255})
+}
+
+func TestIterNextWithoutIterator(t *testing.T) {
+	instructions := append(code.Make(code.OpTrue), code.Make(code.OpIterNext, 4)...)
+	vm := New(&compiler.Bytecode{Instructions: instructions})
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	if !strings.Contains(err.Error(), "expected an iterator on the stack, got BOOLEAN") {
+		t.Errorf("wrong VM error. got=%q", err.Error())
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "let x = 1; x = 5; x", expected: 5},
+		{input: "let x = 1; x = x + 1", expected: 2},
+		{input: "let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", expected: 6},
+		{input: "let a = 1; let b = 2; a = b = 7; a + b", expected: 14},
+		{input: "let x = 1; let f = fn() { x = 9; }; f(); x", expected: 9},
+		{input: "let f = fn() { let x = 1; let g = fn() { x += 2; }; g(); g(); x }; f()", expected: 5},
+		{input: "let counter = fn() { let c = 0; fn() { c += 1 } }; let inc = counter(); inc(); inc(); inc()", expected: 3},
+		{input: "let c = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }(); c[0](); c[0](); c[1]()", expected: 2},
+		{input: "let f = fn(n) { let g = fn() { let h = fn() { n *= 3; }; h(); }; g(); n }; f(2)", expected: 6},
+		{input: "let i = 0; let s = 0; while (i < 5) { i += 1; s += i; }; s", expected: 15},
+		{input: "let arr = [1, 2, 3]; arr[0] = 10; arr[2] *= 3; arr[0] + arr[1] + arr[2]", expected: 21},
+		{input: "let h = {\"a\": 1}; h[\"a\"] += 4; h[\"b\"] = 2; h[\"a\"] + h[\"b\"]", expected: 7},
+		{input: "let arr = [0]; let f = fn(a) { a[0] = 42; }; f(arr); arr[0]", expected: 42},
+		{input: "let f = fn(x) { x = x * 2; x }; f(4)", expected: 8},
+		{input: "let f = fn() { f = 2; }; f(); f", expected: 2},
+		{input: "let f = fn() { f = 2; f }; f()", expected: 2},
+		{input: "let f = fn() { let g = fn() { f = 5; }; g(); 1 }; f(); f", expected: 5},
+		{input: "let outer = fn() { let f = fn() { let g = fn() { f = 5; }; g(); 1 }; f(); f }; outer()", expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmTests(t, tt)
+		})
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{"let a = [1]; a[\"x\"] = 2", "array index must be INTEGER, got STRING"},
+		{"let s = \"ab\"; s[0] = \"c\"", "index assignment not supported: STRING"},
+		{"let h = {}; h[fn() {}] = 1", "unusable as hash key: CLOSURE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmErrorTest(t, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestArithmeticFaults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"let x = 0; 10 / x", "division by zero"},
+		{"let x = 10; x /= 0", "division by zero"},
+		{"let f = fn(a, b) { a % b }; f(7, 0)", "division by zero"},
+		{"99999999999999999999 / 0", "division by zero"},
+		{"99999999999999999999 % (1 - 1)", "division by zero"},
+		{"let a = [1]; a[0] /= 0", "division by zero"},
+		{"let total = 0; for (i in range(-2, 3)) { total = total + 10 / i }", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			runVmErrorTest(t, tt.input, tt.expected)
+		})
+	}
+}
+
+// TestArithmeticEdgeCases 溢出的运算提升为大整数而不是报错或回绕
+func TestArithmeticEdgeCases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any // 字符串表示期望得到大整数
+	}{
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) % -1", 0},
+		{"(-9223372036854775807 - 1) * -1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1) / 2", 4611686018427387904},
+		{"-7 / 2", -3},
+		{"-7 % 2", -1},
+		{"1 / 0.0 > 99999999999999999999", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expected := tt.expected
+			if s, ok := expected.(string); ok {
+				expected, _ = new(big.Int).SetString(s, 10)
+			}
+			runVmTests(t, vmTestCase{input: tt.input, expected: expected})
+		})
+	}
+}
+
+func TestRuntimeErrorPosition(t *testing.T) {
+	input := `let f = fn(a) {
+  a + true
+};
+f(1);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler fail.%s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	if err.Error() != "2:5: unsupport types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong VM error. got=%q", err.Error())
+	}
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+  x + true
+};
+let outer = fn(y) { inner(y) };
+let anon = fn() { outer(1) };
+anon();`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler fail.%s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	d, ok := err.(*diagnostic.Diagnostic)
+	if !ok {
+		t.Fatalf("error is not *diagnostic.Diagnostic. got=%T(%+v)", err, err)
+	}
+
+	expected := []string{"inner (2:5)", "outer (4:26)", "anon (5:24)", "<main> (6:5)"}
+	if len(d.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d (%v)", len(expected), len(d.Trace), d.Trace)
+	}
+	for i, frame := range d.Trace {
+		if frame.String() != expected[i] {
+			t.Errorf("frame %d wrong. want=%q, got=%q", i, expected[i], frame.String())
+		}
+	}
+}